@@ -2,17 +2,16 @@ package cmd
 
 import (
 	"fmt"
-	"io"
 	"net/http"
-	"net/http/httptest"
 	"os"
 	"path/filepath"
-	"regexp"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/ZacxDev/go-static-site/handlers"
 	"github.com/ZacxDev/go-static-site/utils"
-	"github.com/gorilla/mux"
 	"github.com/spf13/cobra"
 )
 
@@ -22,9 +21,11 @@ var buildCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Building static site...")
 
-		router, err := handlers.SetupRouter()
+		drafts, _ := cmd.Flags().GetBool("drafts")
+		future, _ := cmd.Flags().GetBool("future")
+		site, err := handlers.LoadSite(manifestPath, handlers.PublishOptions{Drafts: drafts, Future: future})
 		if err != nil {
-			fmt.Printf("Error setting up router: %v\n", err)
+			fmt.Printf("Error loading site: %v\n", err)
 			os.Exit(1)
 		}
 
@@ -57,88 +58,284 @@ var buildCmd = &cobra.Command{
 		}
 
 		// Generate static pages
-		server := httptest.NewServer(router)
-		defer server.Close()
+		jobs, _ := cmd.Flags().GetInt("jobs")
+		if jobs < 1 {
+			jobs = runtime.GOMAXPROCS(0)
+		}
+
+		// The previous cache is loaded even when forced, it is the only
+		// record of outputs left behind by removed routes
+		force, _ := cmd.Flags().GetBool("force")
+		cache, err := utils.LoadBuildCache(buildCachePath)
+		if err != nil {
+			fmt.Printf("Error loading build cache: %v\n", err)
+			os.Exit(1)
+		}
 
-		langPattern := regexp.MustCompile(`\/\{lang:([^}]+)\}\/`)
+		nextCache, pageErrs := generateStaticPages(site.Renderer, site.Pages, jobs, cache, force)
 
-		router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
-			path, err := route.GetPathTemplate()
+		// Remove outputs of routes that no longer exist
+		for urlPath, entry := range cache.Pages {
+			if _, ok := nextCache.Pages[urlPath]; ok || pageExists(site.Pages, urlPath) {
+				continue
+			}
+			err := removeOutput(entry.Output)
 			if err != nil {
-				return nil // Skip routes without a path template
+				fmt.Printf("Error removing stale page %s: %v\n", entry.Output, err)
+				continue
 			}
+			fmt.Printf("Removed %s\n", entry.Output)
+		}
+
+		// Other outputs are unchanged until they are generated below
+		nextCache.Files = append([]string(nil), cache.Files...)
+		err = nextCache.Save(buildCachePath)
+		if err != nil {
+			fmt.Printf("Error saving build cache: %v\n", err)
+		}
 
-			// Skip sitemap because we generate that seperately
-			if path == "/sitemap.xml" {
-				return nil
+		if len(pageErrs) > 0 {
+			for _, err := range pageErrs {
+				fmt.Println(err)
 			}
+			fmt.Printf("Build failed: %d of %d pages could not be generated\n", len(pageErrs), len(site.Pages))
+			os.Exit(1)
+		}
 
-			matches := langPattern.FindStringSubmatch(path)
-			if len(matches) > 1 {
-				langs := strings.Split(matches[1], "|")
+		// Generate sitemaps
+		sitemaps, err := site.Sitemaps()
+		if err == nil {
+			err = utils.WriteSitemaps(sitemaps)
+		}
+		if err != nil {
+			fmt.Printf("Error generating sitemap: %s\n", err.Error())
+			os.Exit(1)
+		}
 
-				// Base route without the language pattern
-				baseRoute := langPattern.ReplaceAllString(path, "/")
+		// Feeds, the highlight stylesheet and robots.txt are recorded in the
+		// cache as they are written
+		written := utils.NewBuildCache()
 
-				// Generate URLs for each supported language
-				for _, lang := range langs {
-					langPath := fmt.Sprintf("/%s%s", lang, baseRoute)
-					err := generateStaticPage(server, langPath, lang)
-					if err != nil {
-						fmt.Printf("Error generating static page for %s: %v\n", langPath, err)
-					}
-				}
-			} else {
-				// Handle non-language specific routes
-				err := generateStaticPage(server, path, "")
-				if err != nil {
-					fmt.Printf("Error generating static page for %s: %v\n", path, err)
-				}
+		// Generate feeds
+		feeds, err := site.Feeds()
+		if err == nil {
+			err = writeFeeds(feeds, written)
+		}
+		if err != nil {
+			fmt.Printf("Error generating feeds: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Generate the syntax highlighting theme
+		if path, css, ok := site.HighlightStylesheet(); ok {
+			err = writePublicFile(path, css, written)
+			if err != nil {
+				fmt.Printf("Error generating highlight stylesheet: %v\n", err)
+				os.Exit(1)
 			}
+		}
 
-			return nil
-		})
+		// Generate robots.txt
+		if robots, ok := site.RobotsTxt(sitemaps); ok {
+			err = writePublicFile("/robots.txt", []byte(robots), written)
+			if err != nil {
+				fmt.Printf("Error generating robots.txt: %v\n", err)
+				os.Exit(1)
+			}
+		}
 
-		// Generate sitemaps
-		err = utils.GenerateSitemaps(handlers.GetRegisteredRoutes())
+		// Remove files generated by an earlier build that are no longer
+		// configured, files the build didn't generate are left alone
+		for _, file := range nextCache.Files {
+			if written.HasFile(file) {
+				continue
+			}
+			err := removeOutput(file)
+			if err != nil {
+				fmt.Printf("Error removing stale file %s: %v\n", file, err)
+				continue
+			}
+			fmt.Printf("Removed %s\n", file)
+		}
+		nextCache.Files = written.Files
+
+		err = nextCache.Save(buildCachePath)
 		if err != nil {
-			fmt.Printf("Error generating sitemap: %s\n", err.Error())
+			fmt.Printf("Error saving build cache: %v\n", err)
 		}
 
 		fmt.Println("Static site generated successfully in the ./public directory")
 	},
 }
 
-func generateStaticPage(server *httptest.Server, route string, lang string) error {
-	url := server.URL + route
-	resp, err := http.Get(url)
+func writeFeeds(feeds []handlers.FeedFile, cache *utils.BuildCache) error {
+	for _, feed := range feeds {
+		err := writePublicFile(feed.Path, feed.Content, cache)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePublicFile writes content to the output file served at urlPath and
+// records it in cache
+func writePublicFile(urlPath string, content []byte, cache *utils.BuildCache) error {
+	path := filepath.Join("public", filepath.FromSlash(urlPath))
+	err := os.MkdirAll(filepath.Dir(path), 0755)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	err = os.WriteFile(path, content, 0644)
 	if err != nil {
 		return err
 	}
+	cache.AddFile(path)
+	return nil
+}
+
+// generateStaticPages renders pages using a pool of jobs workers, reusing
+// pages from cache whose inputs are unchanged unless force is set. Errors
+// are returned in the same order as pages regardless of which worker hit them
+func generateStaticPages(
+	renderer *handlers.Renderer,
+	pages []handlers.PageRoute,
+	jobs int,
+	cache *utils.BuildCache,
+	force bool,
+) (*utils.BuildCache, []error) {
+	results := make([]error, len(pages))
+	entries := make([]*utils.BuildCacheEntry, len(pages))
+	hasher := utils.NewFileHasher()
+	indexes := make(chan int)
+	var done, unchanged int64
+	var wg sync.WaitGroup
+
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				page := pages[i]
+				fingerprint := renderer.Fingerprint(page)
+				if entry, ok := cache.Pages[page.URLPath]; ok && !force && entry.IsFresh(fingerprint, hasher) {
+					entries[i] = &entry
+					atomic.AddInt64(&done, 1)
+					atomic.AddInt64(&unchanged, 1)
+					continue
+				}
+
+				filePath, deps, err := generateStaticPage(renderer, page)
+				n := atomic.AddInt64(&done, 1)
+				if err != nil {
+					results[i] = fmt.Errorf("Error generating static page for %s: %v", page.URLPath, err)
+					fmt.Printf("[%d/%d] Failed %s\n", n, len(pages), page.URLPath)
+					continue
+				}
+
+				entries[i] = &utils.BuildCacheEntry{
+					Output:       filePath,
+					Fingerprint:  fingerprint,
+					Dependencies: hasher.HashAll(deps),
+				}
+				fmt.Printf("[%d/%d] Generated %s\n", n, len(pages), filePath)
+			}
+		}()
+	}
+
+	for i := range pages {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if unchanged > 0 {
+		fmt.Printf("%d of %d pages unchanged since the last build\n", unchanged, len(pages))
+	}
+
+	nextCache := utils.NewBuildCache()
+	var errs []error
+	for i, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if entries[i] != nil {
+			nextCache.Pages[pages[i].URLPath] = *entries[i]
+		}
+	}
+
+	return nextCache, errs
+}
+
+func generateStaticPage(renderer *handlers.Renderer, page handlers.PageRoute) (string, []string, error) {
+	rendered, err := renderer.Render(page)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if rendered.Status != http.StatusOK {
+		return "", nil, fmt.Errorf("unexpected status %d", rendered.Status)
+	}
 
-	filePath := filepath.Join("public", route[1:], "index.html")
+	filePath := outputPath(page.URLPath, rendered.ContentType)
 	err = os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
 
-	err = os.WriteFile(filePath, body, 0644)
+	err = os.WriteFile(filePath, rendered.Body, 0644)
 	if err != nil {
+		return "", nil, err
+	}
+
+	return filePath, rendered.Dependencies, nil
+}
+
+func pageExists(pages []handlers.PageRoute, urlPath string) bool {
+	for _, page := range pages {
+		if page.URLPath == urlPath {
+			return true
+		}
+	}
+	return false
+}
+
+// removeOutput deletes a generated file along with any directories under
+// public that are left empty
+func removeOutput(path string) error {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
-	fmt.Printf("Generated %s\n", filePath)
+	for dir := filepath.Dir(path); dir != "public" && dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
 	return nil
 }
 
+// outputPath maps a URL path to its file under public, HTML pages are
+// written as index.html inside a directory named after the path
+func outputPath(urlPath string, contentType string) string {
+	if strings.HasPrefix(contentType, "text/html") {
+		return filepath.Join("public", urlPath, "index.html")
+	}
+
+	return filepath.Join("public", urlPath)
+}
+
+// buildCachePath is where build records page dependencies between runs
+const buildCachePath = ".go-static-site/build-cache.json"
+
 func init() {
 	rootCmd.AddCommand(buildCmd)
+	buildCmd.Flags().IntP("jobs", "j", 0, "Number of pages to render concurrently (defaults to GOMAXPROCS)")
+	buildCmd.Flags().Bool("force", false, "Render every page even if unchanged since the last build")
+	buildCmd.Flags().Bool("drafts", false, "Include pages marked as drafts")
+	buildCmd.Flags().Bool("future", false, "Include pages whose publish_date is in the future")
 }
 
 func copyFile(src, dst string) error {
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ZacxDev/go-static-site/config"
+	"github.com/spf13/cobra"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Validate the manifest and every file it references",
+	Run: func(cmd *cobra.Command, args []string) {
+		_, err := config.LoadManifest(manifestPath)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("%s is valid\n", manifestPath)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+}
@@ -7,6 +7,9 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// manifestPath is the site manifest, relative to the directory commands are run from
+const manifestPath = "manifest.yaml"
+
 var rootCmd = &cobra.Command{
 	Use:   "go-static-site",
 	Short: "go-static-site - generate static sites from a single manifest file",
@@ -4,8 +4,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/ZacxDev/go-static-site/config"
 	"github.com/ZacxDev/go-static-site/handlers"
+	"github.com/ZacxDev/go-static-site/livereload"
 	"github.com/spf13/cobra"
 )
 
@@ -14,18 +21,218 @@ var serveCmd = &cobra.Command{
 	Short: "Start the server",
 	Run: func(cmd *cobra.Command, args []string) {
 		port, _ := cmd.Flags().GetString("port")
+		liveReload, _ := cmd.Flags().GetBool("live-reload")
 		fmt.Printf("Starting server on port %s\n", port)
 
-		router, err := handlers.SetupRouter()
+		drafts, _ := cmd.Flags().GetBool("drafts")
+		future, _ := cmd.Flags().GetBool("future")
+		site, err := handlers.LoadSite(manifestPath, handlers.PublishOptions{Drafts: drafts, Future: future})
 		if err != nil {
 			log.Fatalf("Error setting up router: %v", err)
 		}
+		site.ErrorOverlay = liveReload
 
-		log.Fatal(http.ListenAndServe(":"+port, router))
+		router, err := handlers.NewRouter(site)
+		if err != nil {
+			log.Fatalf("Error setting up router: %v", err)
+		}
+
+		if !liveReload {
+			log.Fatal(http.ListenAndServe(":"+port, router))
+		}
+
+		dev := newDevServer(site, router)
+		go dev.watcher.Run(nil, dev.onChange)
+
+		log.Fatal(http.ListenAndServe(":"+port, dev))
 	},
 }
 
+// devServer serves the site while watching its sources, rebuilding and
+// swapping the router whenever they change and telling connected browsers
+// to reload
+type devServer struct {
+	mu      sync.Mutex
+	site    *handlers.Site
+	handler atomic.Value
+	broker  *livereload.Broker
+	watcher *livereload.Watcher
+
+	// recompileJS is set when a rebuild touching javascript failed, so the
+	// next rebuild compiles it again even if only pages changed
+	recompileJS bool
+}
+
+func newDevServer(site *handlers.Site, router http.Handler) *devServer {
+	d := &devServer{
+		site:    site,
+		broker:  livereload.NewBroker(),
+		watcher: livereload.NewWatcher(300 * time.Millisecond),
+	}
+	d.handler.Store(livereload.InjectScript(router))
+	d.watchSite()
+
+	return d
+}
+
+func (d *devServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == livereload.EventsPath {
+		d.broker.ServeHTTP(w, r)
+		return
+	}
+
+	d.handler.Load().(http.Handler).ServeHTTP(w, r)
+}
+
+// watchSite points the watcher at every source the current manifest
+// references. Javascript output directories are ignored since compiling
+// writes into them
+func (d *devServer) watchSite() {
+	manifest := d.site.Manifest
+	paths := []string{manifestPath, "pages", "templates", "static"}
+	var ignore []string
+
+	for _, partial := range manifest.Partials {
+		paths = append(paths, partial.Source)
+	}
+	paths = append(paths, d.site.Layouts()...)
+	for _, shortcode := range manifest.Shortcodes {
+		paths = append(paths, shortcode.Source)
+	}
+	wrappers := []string{manifest.Markdown.Wrapper}
+	for _, route := range manifest.Routes {
+		wrappers = append(wrappers, manifest.MarkdownWrapper(route))
+	}
+	for _, wrapper := range wrappers {
+		if wrapper != "" && wrapper != config.NoMarkdownWrapper {
+			paths = append(paths, wrapper)
+		}
+	}
+	for _, taxonomy := range manifest.Taxonomies {
+		paths = append(paths, taxonomy.TermTemplate)
+		if taxonomy.IndexTemplate != "" {
+			paths = append(paths, taxonomy.IndexTemplate)
+		}
+	}
+	for _, tr := range manifest.Translations {
+		paths = append(paths, tr.Source)
+	}
+	for _, target := range manifest.JavascriptTargets {
+		paths = append(paths, javascriptSourceRoot(target.Source))
+		ignore = append(ignore, target.OutDir)
+	}
+	ignore = append(ignore, "public", filepath.Dir(buildCachePath))
+
+	d.watcher.SetPaths(paths, ignore)
+}
+
+func (d *devServer) onChange(changed []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	fmt.Printf("Changed: %s\n", strings.Join(changed, ", "))
+
+	if stylesheets, ok := d.onlyStylesheets(changed); ok {
+		for _, href := range stylesheets {
+			d.broker.Broadcast(livereload.EventCSS, href)
+		}
+		return
+	}
+
+	if d.onlyStatic(changed) {
+		d.broker.Broadcast(livereload.EventReload, "")
+		return
+	}
+
+	var site *handlers.Site
+	var err error
+	compileJS := d.recompileJS || d.touchesJavascript(changed)
+	if compileJS {
+		site, err = handlers.LoadSite(manifestPath, d.site.Publish)
+	} else {
+		site, err = handlers.ReloadSite(manifestPath, d.site)
+	}
+	if err != nil {
+		d.showError(err, compileJS)
+		return
+	}
+	site.ErrorOverlay = true
+
+	router, err := handlers.NewRouter(site)
+	if err != nil {
+		d.showError(err, compileJS)
+		return
+	}
+
+	d.site = site
+	d.recompileJS = false
+	d.handler.Store(livereload.InjectScript(router))
+	d.watchSite()
+
+	fmt.Println("Rebuilt site")
+	d.broker.Broadcast(livereload.EventReload, "")
+}
+
+// showError serves an error overlay for every page until the next
+// successful rebuild
+func (d *devServer) showError(err error, compileJS bool) {
+	fmt.Printf("Error rebuilding site: %v\n", err)
+
+	d.recompileJS = compileJS
+	d.handler.Store(livereload.InjectScript(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.WriteErrorOverlay(w, err)
+	})))
+	d.broker.Broadcast(livereload.EventReload, "")
+}
+
+// onlyStylesheets returns the public paths of the changed stylesheets when
+// nothing but css under static changed
+func (d *devServer) onlyStylesheets(changed []string) ([]string, bool) {
+	var hrefs []string
+	for _, path := range changed {
+		if !livereload.IsWithin(path, "static") || filepath.Ext(path) != ".css" {
+			return nil, false
+		}
+		hrefs = append(hrefs, "/"+filepath.ToSlash(path))
+	}
+	return hrefs, true
+}
+
+func (d *devServer) onlyStatic(changed []string) bool {
+	for _, path := range changed {
+		if !livereload.IsWithin(path, "static") {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *devServer) touchesJavascript(changed []string) bool {
+	for _, target := range d.site.Manifest.JavascriptTargets {
+		root := javascriptSourceRoot(target.Source)
+		for _, path := range changed {
+			if path == filepath.Clean(target.Source) || livereload.IsWithin(path, root) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// javascriptSourceRoot is the directory watched for a javascript entry
+// point, entry points at the project root only watch themselves
+func javascriptSourceRoot(source string) string {
+	dir := filepath.Dir(source)
+	if dir == "." {
+		return source
+	}
+	return dir
+}
+
 func init() {
 	rootCmd.AddCommand(serveCmd)
 	serveCmd.Flags().StringP("port", "p", "9010", "Port to run the server on")
+	serveCmd.Flags().Bool("live-reload", true, "Watch sources, rebuild on change and reload connected browsers")
+	serveCmd.Flags().Bool("drafts", false, "Include pages marked as drafts")
+	serveCmd.Flags().Bool("future", false, "Include pages whose publish_date is in the future")
 }
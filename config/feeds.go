@@ -0,0 +1,48 @@
+package config
+
+import "strings"
+
+// FeedFormats are the supported feed formats and the file each is written to
+var FeedFormats = map[string]string{
+	"rss":  "rss.xml",
+	"atom": "atom.xml",
+	"json": "feed.json",
+}
+
+// defaultFeedLimit is the number of items in feeds that don't set a limit
+const defaultFeedLimit = 20
+
+// BasePath returns the directory the feed files are served from
+func (f Feed) BasePath() string {
+	if f.Path != "" {
+		return f.Path
+	}
+	if i := strings.Index(f.Route, "/:"); i != -1 {
+		return f.Route[:i]
+	}
+	return f.Route
+}
+
+// FormatList returns the formats to generate in a stable order
+func (f Feed) FormatList() []string {
+	if len(f.Formats) == 0 {
+		return []string{"rss", "atom", "json"}
+	}
+	return f.Formats
+}
+
+// ItemLimit returns the maximum number of items in the feed
+func (f Feed) ItemLimit() int {
+	if f.Limit > 0 {
+		return f.Limit
+	}
+	return defaultFeedLimit
+}
+
+// SummaryField returns the frontmatter key used as an item's summary
+func (f Feed) SummaryField() string {
+	if f.SummaryKey != "" {
+		return f.SummaryKey
+	}
+	return "description"
+}
@@ -0,0 +1,83 @@
+package config
+
+// defaultHighlightCSSPath is where the generated theme is served when
+// highlighting uses classes
+const defaultHighlightCSSPath = "/highlight.css"
+
+// HighlightTheme colors highlighted code. Tokens maps the token classes kwd,
+// str, com, typ, lit, pun, pln, tag, htm, atn, atv and dec to CSS
+// declarations
+type HighlightTheme struct {
+	Background      string
+	Foreground      string
+	LineNumber      string
+	HighlightedLine string
+	Tokens          map[string]string
+}
+
+// HighlightThemes lists the themes by the name used in the manifest
+var HighlightThemes = map[string]HighlightTheme{
+	"github": {
+		Background:      "#f6f8fa",
+		Foreground:      "#24292e",
+		LineNumber:      "#959da5",
+		HighlightedLine: "#fffbdd",
+		Tokens: map[string]string{
+			"kwd": "color:#d73a49",
+			"str": "color:#032f62",
+			"com": "color:#6a737d;font-style:italic",
+			"typ": "color:#6f42c1",
+			"lit": "color:#005cc5",
+			"dec": "color:#005cc5",
+			"pun": "color:#24292e",
+			"tag": "color:#22863a",
+			"htm": "color:#22863a",
+			"atn": "color:#6f42c1",
+			"atv": "color:#032f62",
+		},
+	},
+	"monokai": {
+		Background:      "#272822",
+		Foreground:      "#f8f8f2",
+		LineNumber:      "#75715e",
+		HighlightedLine: "#3e3d32",
+		Tokens: map[string]string{
+			"kwd": "color:#f92672",
+			"str": "color:#e6db74",
+			"com": "color:#75715e;font-style:italic",
+			"typ": "color:#66d9ef",
+			"lit": "color:#ae81ff",
+			"dec": "color:#ae81ff",
+			"pun": "color:#f8f8f2",
+			"tag": "color:#f92672",
+			"htm": "color:#f92672",
+			"atn": "color:#a6e22e",
+			"atv": "color:#e6db74",
+		},
+	},
+}
+
+// ThemeOrDefault returns the configured theme, github when unset
+func (h *Highlight) ThemeOrDefault() HighlightTheme {
+	if theme, ok := HighlightThemes[h.Theme]; ok {
+		return theme
+	}
+	return HighlightThemes["github"]
+}
+
+// Inline reports whether styles are written into the markup instead of
+// classes styled by the generated theme
+func (h *Highlight) Inline() bool {
+	return h.Style == "inline"
+}
+
+// CSSPath is the URL path of the generated theme, empty with inline styles
+func (h *Highlight) CSSPath() string {
+	if h.Inline() {
+		return ""
+	}
+	if h.Path != "" {
+		return h.Path
+	}
+	return defaultHighlightCSSPath
+}
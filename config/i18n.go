@@ -0,0 +1,59 @@
+package config
+
+import "strings"
+
+// fallbackLanguage is used when the manifest declares neither translations
+// nor a default language
+const fallbackLanguage = "en"
+
+// Languages returns the language codes the site is built in, in manifest
+// order. Sites without translations are built in their default language only
+func (m *SiteManifest) Languages() []string {
+	if len(m.Translations) == 0 {
+		return []string{m.DefaultLanguage()}
+	}
+
+	langs := make([]string, 0, len(m.Translations))
+	for _, tr := range m.Translations {
+		langs = append(langs, tr.Code)
+	}
+	return langs
+}
+
+// DefaultLanguage is the language pages are rendered in when the URL doesn't
+// name one
+func (m *SiteManifest) DefaultLanguage() string {
+	if m.I18n.DefaultLanguage != "" {
+		return m.I18n.DefaultLanguage
+	}
+	if len(m.Translations) > 0 {
+		return m.Translations[0].Code
+	}
+	return fallbackLanguage
+}
+
+// IsMultilingual reports whether pages are served under language prefixes
+func (m *SiteManifest) IsMultilingual() bool {
+	return len(m.Translations) > 0
+}
+
+// IsPrefixed reports whether pages in lang live under a /{lang} prefix
+func (m *SiteManifest) IsPrefixed(lang string) bool {
+	if !m.IsMultilingual() {
+		return false
+	}
+	return lang != m.DefaultLanguage() || !m.I18n.UnprefixedDefaultLanguage
+}
+
+// LocalizedPath returns the canonical URL path of path in lang
+func (m *SiteManifest) LocalizedPath(lang string, path string) string {
+	if !m.IsPrefixed(lang) {
+		return path
+	}
+	return "/" + lang + path
+}
+
+// URL returns the absolute URL of a URL path on the site's origin
+func (m *SiteManifest) URL(path string) string {
+	return strings.TrimRight(m.Origin, "/") + path
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ZacxDev/go-static-site/frontmatter"
+)
+
+// LayoutDir holds the layouts that can be referenced by name
+const LayoutDir = "templates/layouts"
+
+// MaxLayoutDepth caps how many layouts can be nested into each other
+const MaxLayoutDepth = 10
+
+// LayoutSource resolves a layout reference to its file. Bare names such as
+// "docs" refer to templates/layouts/docs.plush.html, anything else is used
+// as a path
+func LayoutSource(name string) string {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasSuffix(name, ".html") {
+		return name
+	}
+	return filepath.Join(LayoutDir, name+".plush.html")
+}
+
+// RouteLayout is the layout a route's pages are rendered into unless their
+// frontmatter picks another: the route's own, the manifest's default or
+// the base layout
+func (m *SiteManifest) RouteLayout(route Route) string {
+	switch {
+	case route.Layout != "":
+		return LayoutSource(route.Layout)
+	case m.DefaultLayout != "":
+		return LayoutSource(m.DefaultLayout)
+	}
+	return BaseLayoutSource
+}
+
+// ParentLayout reads the layout a layout yields into from its frontmatter,
+// returning "" for a top level layout
+func ParentLayout(source string) (string, error) {
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return "", err
+	}
+	doc, err := frontmatter.Parse(content)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", source, err)
+	}
+	parent, _ := doc.Params["layout"].(string)
+	return LayoutSource(parent), nil
+}
+
+// LayoutChain lists source and every layout it is nested into, innermost
+// first
+func LayoutChain(source string) ([]string, error) {
+	var chain []string
+	for source != "" {
+		for _, seen := range chain {
+			if seen == source {
+				return chain, fmt.Errorf("circular layout: %s", strings.Join(append(chain, source), " -> "))
+			}
+		}
+		if len(chain) >= MaxLayoutDepth {
+			return chain, fmt.Errorf("maximum layout nesting depth (%d) exceeded", MaxLayoutDepth)
+		}
+		chain = append(chain, source)
+
+		parent, err := ParentLayout(source)
+		if err != nil {
+			return chain, err
+		}
+		source = parent
+	}
+	return chain, nil
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+)
+
+// LineIndex maps manifest paths such as "routes[2].source" to the line they
+// are declared on. yaml.v2 doesn't expose node positions so the index is
+// built from the block structure of the document, flow style collections
+// are attributed to the line of their key
+type LineIndex map[string]int
+
+type lineFrame struct {
+	indent    int
+	path      string
+	isItem    bool
+	nextIndex int
+}
+
+// IndexLines builds a LineIndex for a block style YAML document
+func IndexLines(data []byte) LineIndex {
+	index := make(LineIndex)
+	stack := []*lineFrame{{indent: -1}}
+
+	for n, raw := range strings.Split(string(data), "\n") {
+		line := n + 1
+		text := strings.TrimRight(raw, " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		indent := len(text) - len(trimmed)
+
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			for len(stack) > 1 {
+				top := stack[len(stack)-1]
+				if top.indent > indent || (top.isItem && top.indent >= indent) {
+					stack = stack[:len(stack)-1]
+					continue
+				}
+				break
+			}
+
+			parent := stack[len(stack)-1]
+			itemPath := parent.path + "[" + strconv.Itoa(parent.nextIndex) + "]"
+			parent.nextIndex++
+			index[itemPath] = line
+
+			item := &lineFrame{indent: indent, path: itemPath, isItem: true}
+			stack = append(stack, item)
+
+			rest := strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))
+			if key, hasValue, ok := splitKey(rest); ok {
+				keyIndent := indent + (len(trimmed) - len(strings.TrimLeft(trimmed[1:], " ")))
+				stack = indexKey(index, stack, keyIndent, key, hasValue, line)
+			}
+			continue
+		}
+
+		for len(stack) > 1 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+
+		if key, hasValue, ok := splitKey(trimmed); ok {
+			stack = indexKey(index, stack, indent, key, hasValue, line)
+		}
+	}
+
+	return index
+}
+
+func indexKey(index LineIndex, stack []*lineFrame, indent int, key string, hasValue bool, line int) []*lineFrame {
+	parent := stack[len(stack)-1]
+	path := key
+	if parent.path != "" {
+		path = parent.path + "." + key
+	}
+	index[path] = line
+
+	if !hasValue {
+		stack = append(stack, &lineFrame{indent: indent, path: path})
+	}
+	return stack
+}
+
+// splitKey parses `key:` or `key: value`, ok is false for plain scalars
+func splitKey(text string) (key string, hasValue bool, ok bool) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, `'`) {
+		quote := text[:1]
+		end := strings.Index(text[1:], quote)
+		if end == -1 {
+			return "", false, false
+		}
+		key = text[1 : end+1]
+		text = text[end+2:]
+		if !strings.HasPrefix(text, ":") {
+			return "", false, false
+		}
+		rest := strings.TrimSpace(text[1:])
+		return key, rest != "" && !strings.HasPrefix(rest, "#"), true
+	}
+
+	i := strings.Index(text, ":")
+	if i <= 0 || (i+1 < len(text) && text[i+1] != ' ') {
+		return "", false, false
+	}
+	rest := strings.TrimSpace(text[i+1:])
+	return strings.TrimSpace(text[:i]), rest != "" && !strings.HasPrefix(rest, "#"), true
+}
+
+// Line returns the line path is declared on, falling back to its closest
+// declared parent. It returns 0 when nothing along the path was found
+func (li LineIndex) Line(path string) int {
+	for path != "" {
+		if line, ok := li[path]; ok {
+			return line
+		}
+
+		i := strings.LastIndexAny(path, ".[")
+		if i == -1 {
+			return 0
+		}
+		path = path[:i]
+	}
+	return 0
+}
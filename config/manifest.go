@@ -0,0 +1,581 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// PartialCallPattern matches partial tags: <%= partial("name") %>
+var PartialCallPattern = regexp.MustCompile(`<%=\s*partial\("([^"]+)"\)\s*%>`)
+
+// partialRefPattern matches every partial call, including those with
+// arguments: partial("card", {"title": "Docs"})
+var partialRefPattern = regexp.MustCompile(`\bpartial\(\s*"([^"]+)"`)
+
+// BaseLayoutSource is the layout pages are rendered into when neither
+// their route nor the manifest sets one
+const BaseLayoutSource = "templates/layouts/base.plush.html"
+
+var (
+	routeParamPattern    = regexp.MustCompile(`:\w+`)
+	sourceParamPattern   = regexp.MustCompile(`\[\w+\]`)
+	yamlTypeErrorLineRe  = regexp.MustCompile(`^\s*line (\d+): (.*)$`)
+	shortcodeNamePattern = regexp.MustCompile(`^[A-Za-z][\w-]*$`)
+)
+
+var changeFreqs = map[string]bool{
+	"always":  true,
+	"hourly":  true,
+	"daily":   true,
+	"weekly":  true,
+	"monthly": true,
+	"yearly":  true,
+	"never":   true,
+}
+
+// Problem is a single issue found in a manifest, Line is 0 when it can't be
+// attributed to a specific line
+type Problem struct {
+	Line    int
+	Message string
+}
+
+// ValidationError reports every problem found in a manifest
+type ValidationError struct {
+	File     string
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s has %d problem(s):", e.File, len(e.Problems))
+	for _, p := range e.Problems {
+		b.WriteString("\n  ")
+		b.WriteString(e.File)
+		if p.Line > 0 {
+			fmt.Fprintf(&b, ":%d", p.Line)
+		}
+		b.WriteString(": ")
+		b.WriteString(p.Message)
+	}
+	return b.String()
+}
+
+// LoadManifest strictly decodes the manifest at filename and validates every
+// file, partial, javascript target and translation it references. All
+// problems are reported together as a *ValidationError
+func LoadManifest(filename string) (*SiteManifest, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest SiteManifest
+	err = yaml.UnmarshalStrict(data, &manifest)
+	problems := decodeProblems(err)
+	if err != nil {
+		// Syntax errors leave nothing to validate, type errors such as
+		// unknown keys still decode the rest of the manifest
+		if _, ok := err.(*yaml.TypeError); !ok {
+			if problems == nil {
+				return nil, err
+			}
+			return nil, &ValidationError{File: filename, Problems: problems}
+		}
+		if problems == nil {
+			problems = []Problem{{Message: err.Error()}}
+		}
+	}
+
+	v := &validator{lines: IndexLines(data), manifest: &manifest, problems: problems}
+	v.validate()
+	if len(v.problems) > 0 {
+		sort.SliceStable(v.problems, func(i, j int) bool {
+			return v.problems[i].Line < v.problems[j].Line
+		})
+		return nil, &ValidationError{File: filename, Problems: v.problems}
+	}
+
+	return &manifest, nil
+}
+
+// decodeProblems splits a yaml.v2 error into per-line problems
+func decodeProblems(err error) []Problem {
+	if err == nil {
+		return nil
+	}
+	var problems []Problem
+	for _, line := range strings.Split(err.Error(), "\n") {
+		line = strings.TrimPrefix(line, "yaml: ")
+		m := yamlTypeErrorLineRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		problems = append(problems, Problem{Line: n, Message: m[2]})
+	}
+	return problems
+}
+
+type validator struct {
+	lines    LineIndex
+	manifest *SiteManifest
+	problems []Problem
+	// layouts caches the chain of every layout checked so problems with a
+	// shared layout are only reported once
+	layouts map[string][]string
+}
+
+func (v *validator) addf(path string, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{
+		Line:    v.lines.Line(path),
+		Message: path + ": " + fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) requireFile(path string, file string) bool {
+	if file == "" {
+		v.addf(path, "is required")
+		return false
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		v.addf(path, "file %s does not exist", file)
+		return false
+	}
+	if info.IsDir() {
+		v.addf(path, "%s is a directory", file)
+		return false
+	}
+	return true
+}
+
+func (v *validator) validate() {
+	m := v.manifest
+
+	if m.Origin == "" {
+		v.addf("origin", "is required to build canonical and sitemap URLs")
+	} else if !strings.HasPrefix(m.Origin, "http://") && !strings.HasPrefix(m.Origin, "https://") {
+		v.addf("origin", "must be an absolute http(s) URL, got %q", m.Origin)
+	}
+
+	if m.NotFoundPageSource != "" {
+		v.requireFile("not_found_page_source", m.NotFoundPageSource)
+	}
+	if m.DefaultLayout != "" {
+		v.layoutChain("default_layout", LayoutSource(m.DefaultLayout))
+	}
+
+	v.validateMarkdown("markdown", m.Markdown)
+
+	for _, name := range SortedKeys(m.Shortcodes) {
+		path := "shortcodes." + name
+		if !shortcodeNamePattern.MatchString(name) {
+			v.addf(path, "invalid shortcode name %q, expected letters, digits, - and _", name)
+		}
+		v.requireFile(path+".source", m.Shortcodes[name].Source)
+	}
+
+	langs := make(map[string]bool)
+	for i, tr := range m.Translations {
+		path := fmt.Sprintf("translations[%d]", i)
+		if tr.Code == "" {
+			v.addf(path+".code", "is required")
+		} else if langs[tr.Code] {
+			v.addf(path+".code", "duplicate language %s", tr.Code)
+		}
+		langs[tr.Code] = true
+
+		if tr.SourceType != "YAML" {
+			v.addf(path+".source_type", "unsupported translation source type %q, expected YAML", tr.SourceType)
+		}
+		v.requireFile(path+".source", tr.Source)
+	}
+
+	for _, name := range SortedKeys(m.Partials) {
+		partial := m.Partials[name]
+		path := "partials." + name
+		v.requireTemplateType(path+".template_type", partial.TemplateType)
+		v.requireFile(path+".source", partial.Source)
+	}
+
+	for _, name := range SortedKeys(m.JavascriptTargets) {
+		target := m.JavascriptTargets[name]
+		path := "javascript." + name
+		v.requireFile(path+".source", target.Source)
+		if target.OutDir == "" {
+			v.addf(path+".out_dir", "is required")
+		}
+	}
+
+	if m.Sitemap.MaxURLs < 0 || m.Sitemap.MaxURLs > 50000 {
+		v.addf("sitemap.max_urls", "must be between 1 and 50000, or 0 for the protocol limit, got %d", m.Sitemap.MaxURLs)
+	}
+	if m.Sitemap.SplitBy != "" && m.Sitemap.SplitBy != "language" && m.Sitemap.SplitBy != "route" {
+		v.addf("sitemap.split_by", "unsupported value %q, expected language or route", m.Sitemap.SplitBy)
+	}
+
+	if m.Robots != nil {
+		v.validateRobotsRules("robots.rules", m.Robots.Rules)
+		for _, name := range SortedKeys(m.Robots.Environments) {
+			env := m.Robots.Environments[name]
+			path := "robots.environments." + name
+			if env.DisallowAll && len(env.Rules) > 0 {
+				v.addf(path, "disallow_all can't be combined with rules")
+			}
+			v.validateRobotsRules(path+".rules", env.Rules)
+		}
+	}
+
+	for _, name := range SortedKeys(m.Collections) {
+		v.validateCollection("collections."+name, m.Collections[name])
+	}
+
+	for _, name := range SortedKeys(m.Taxonomies) {
+		v.validateTaxonomy("taxonomies."+name, name, m.Taxonomies[name])
+	}
+
+	for _, name := range SortedKeys(m.Feeds) {
+		v.validateFeed("feeds."+name, m.Feeds[name])
+	}
+
+	if m.I18n.DefaultLanguage != "" && len(m.Translations) > 0 && !langs[m.I18n.DefaultLanguage] {
+		v.addf("i18n.default_language", "%s has no entry in translations", m.I18n.DefaultLanguage)
+	}
+
+	paths := make(map[string]bool)
+	for i, route := range m.Routes {
+		v.validateRoute(fmt.Sprintf("routes[%d]", i), route, paths)
+	}
+}
+
+func (v *validator) validateCollection(path string, collection Collection) {
+	if collection.Route == "" {
+		v.addf(path+".route", "is required")
+	} else if route, ok := v.findRoute(collection.Route); !ok {
+		v.addf(path+".route", "unknown route %s", collection.Route)
+	} else if !routeParamPattern.MatchString(route.Path) {
+		v.addf(path+".route", "%s is not a dynamic route such as /blog/:slug", collection.Route)
+	}
+
+	switch collection.SortBy {
+	case "", "date", "title", "weight":
+	default:
+		v.addf(path+".sort_by", "unsupported value %q, expected date, title or weight", collection.SortBy)
+	}
+	switch collection.Order {
+	case "", "asc", "desc":
+	default:
+		v.addf(path+".order", "unsupported value %q, expected asc or desc", collection.Order)
+	}
+}
+
+func (v *validator) validateTaxonomy(path string, name string, taxonomy Taxonomy) {
+	if taxonomy.Collection == "" {
+		v.addf(path+".collection", "is required")
+	} else if _, ok := v.manifest.Collections[taxonomy.Collection]; !ok {
+		v.addf(path+".collection", "unknown collection %s", taxonomy.Collection)
+	}
+
+	taxonomyPath := taxonomy.RoutePath(name)
+	if !strings.HasPrefix(taxonomyPath, "/") {
+		v.addf(path+".path", "must start with /, got %q", taxonomyPath)
+	} else if _, ok := v.findRoute(taxonomyPath); ok {
+		v.addf(path+".path", "%s is already used by a route", taxonomyPath)
+	}
+
+	declared := make(map[string]bool)
+	for j, dep := range taxonomy.PartialDeps {
+		declared[dep] = true
+		if _, ok := v.manifest.Partials[dep]; !ok {
+			v.addf(fmt.Sprintf("%s.partial_deps[%d]", path, j), "unknown partial %s", dep)
+		}
+	}
+
+	sources := v.layoutChain(path+".layout", v.manifest.RouteLayout(Route{Layout: taxonomy.Layout}))
+	if v.requireFile(path+".term_template", taxonomy.TermTemplate) {
+		sources = append(sources, taxonomy.TermTemplate)
+	}
+	if taxonomy.IndexTemplate != "" && v.requireFile(path+".index_template", taxonomy.IndexTemplate) {
+		sources = append(sources, taxonomy.IndexTemplate)
+	}
+	for _, partial := range v.referencedPartials(sources) {
+		if !declared[partial] {
+			v.addf(path+".partial_deps", "partial %s is used but not declared in partial_deps", partial)
+		}
+	}
+}
+
+func (v *validator) validateFeed(path string, feed Feed) {
+	if feed.Route == "" {
+		v.addf(path+".route", "is required")
+	} else if route, ok := v.findRoute(feed.Route); !ok {
+		v.addf(path+".route", "unknown route %s", feed.Route)
+	} else if !routeParamPattern.MatchString(route.Path) {
+		v.addf(path+".route", "%s is not a dynamic route such as /blog/:slug", feed.Route)
+	}
+
+	if feed.Title == "" {
+		v.addf(path+".title", "is required")
+	}
+	if feed.Path != "" && !strings.HasPrefix(feed.Path, "/") {
+		v.addf(path+".path", "must start with /, got %q", feed.Path)
+	}
+	for j, format := range feed.Formats {
+		if _, ok := FeedFormats[format]; !ok {
+			v.addf(fmt.Sprintf("%s.formats[%d]", path, j), "unsupported format %q, expected rss, atom or json", format)
+		}
+	}
+	if feed.Limit < 0 {
+		v.addf(path+".limit", "must be positive, got %d", feed.Limit)
+	}
+}
+
+func (v *validator) validateMarkdown(path string, md Markdown) {
+	for j, name := range md.Extensions {
+		if _, ok := MarkdownExtensions[name]; !ok {
+			v.addf(fmt.Sprintf("%s.extensions[%d]", path, j), "unknown markdown extension %q", name)
+		}
+	}
+	for j, name := range md.DisableExtensions {
+		if _, ok := MarkdownExtensions[name]; !ok {
+			v.addf(fmt.Sprintf("%s.disable_extensions[%d]", path, j), "unknown markdown extension %q", name)
+		}
+	}
+	for j, rel := range md.ExternalLinks.Rel {
+		if _, ok := ExternalLinkRels[rel]; !ok {
+			v.addf(fmt.Sprintf("%s.external_links.rel[%d]", path, j), "unsupported value %q, expected nofollow, noopener or noreferrer", rel)
+		}
+	}
+	if md.Wrapper != "" && md.Wrapper != NoMarkdownWrapper {
+		v.requireFile(path+".wrapper", md.Wrapper)
+	}
+
+	if md.TOC.MinLevel < 0 || md.TOC.MinLevel > 6 {
+		v.addf(path+".toc.min_level", "must be between 1 and 6, got %d", md.TOC.MinLevel)
+	}
+	if md.TOC.MaxLevel < 0 || md.TOC.MaxLevel > 6 {
+		v.addf(path+".toc.max_level", "must be between 1 and 6, got %d", md.TOC.MaxLevel)
+	}
+	if min, max := md.TOC.Levels(); min > max {
+		v.addf(path+".toc", "min_level %d is greater than max_level %d", min, max)
+	}
+
+	if hl := md.Highlight; hl != nil {
+		if _, ok := HighlightThemes[hl.Theme]; hl.Theme != "" && !ok {
+			v.addf(path+".highlight.theme", "unknown theme %q, expected %s", hl.Theme, strings.Join(SortedKeys(HighlightThemes), " or "))
+		}
+		if hl.Style != "" && hl.Style != "classes" && hl.Style != "inline" {
+			v.addf(path+".highlight.style", "unsupported value %q, expected classes or inline", hl.Style)
+		}
+		switch {
+		case hl.Path == "":
+		case hl.Inline():
+			v.addf(path+".highlight.path", "inline styles don't use a stylesheet")
+		case !strings.HasPrefix(hl.Path, "/"):
+			v.addf(path+".highlight.path", "must start with /, got %q", hl.Path)
+		case strings.HasPrefix(hl.Path, "/static/"):
+			v.addf(path+".highlight.path", "%s is served from the static directory", hl.Path)
+		}
+	}
+}
+
+func (v *validator) findRoute(path string) (Route, bool) {
+	for _, route := range v.manifest.Routes {
+		if route.Path == path {
+			return route, true
+		}
+	}
+	return Route{}, false
+}
+
+func (v *validator) validateRobotsRules(path string, rules []RobotsRule) {
+	for i, rule := range rules {
+		if rule.UserAgent == "" {
+			v.addf(fmt.Sprintf("%s[%d].user_agent", path, i), "is required")
+		}
+	}
+}
+
+func (v *validator) requireTemplateType(path string, templateType string) {
+	if templateType != "PLUSH" && templateType != "MARKDOWN" {
+		v.addf(path, "unsupported template type %q, expected PLUSH or MARKDOWN", templateType)
+	}
+}
+
+func (v *validator) validateRoute(path string, route Route, paths map[string]bool) {
+	m := v.manifest
+
+	if !strings.HasPrefix(route.Path, "/") {
+		v.addf(path+".path", "must start with /, got %q", route.Path)
+	} else if paths[route.Path] {
+		v.addf(path+".path", "duplicate route %s", route.Path)
+	}
+	paths[route.Path] = true
+
+	v.requireTemplateType(path+".template_type", route.TemplateType)
+
+	if route.Priority != nil && (*route.Priority < 0 || *route.Priority > 1) {
+		v.addf(path+".priority", "must be between 0.0 and 1.0, got %v", *route.Priority)
+	}
+	if route.ChangeFreq != "" && !changeFreqs[route.ChangeFreq] {
+		v.addf(path+".changefreq", "unsupported value %q, expected one of always, hourly, daily, weekly, monthly, yearly or never", route.ChangeFreq)
+	}
+
+	if route.Paginate != nil {
+		if routeParamPattern.MatchString(route.Path) {
+			v.addf(path+".paginate", "can't paginate dynamic route %s", route.Path)
+		}
+		if route.Paginate.Collection == "" {
+			v.addf(path+".paginate.collection", "is required")
+		} else if _, ok := m.Collections[route.Paginate.Collection]; !ok {
+			v.addf(path+".paginate.collection", "unknown collection %s", route.Paginate.Collection)
+		}
+		if route.Paginate.PerPage < 0 {
+			v.addf(path+".paginate.per_page", "must be positive, got %d", route.Paginate.PerPage)
+		}
+	}
+
+	for j, dep := range route.JavascriptDeps {
+		if _, ok := m.JavascriptTargets[dep]; !ok {
+			v.addf(fmt.Sprintf("%s.javascript_deps[%d]", path, j), "unknown javascript target %s", dep)
+		}
+	}
+
+	declared := make(map[string]bool)
+	for j, dep := range route.PartialDeps {
+		declared[dep] = true
+		if _, ok := m.Partials[dep]; !ok {
+			v.addf(fmt.Sprintf("%s.partial_deps[%d]", path, j), "unknown partial %s", dep)
+		}
+	}
+
+	// Every partial the route's sources and layouts pull in, directly or
+	// through other partials, has to be declared
+	sources := v.layoutChain(path+".layout", m.RouteLayout(route))
+
+	if route.MarkdownWrapper != "" {
+		if route.TemplateType != "MARKDOWN" {
+			v.addf(path+".markdown_wrapper", "only applies to MARKDOWN routes")
+		} else if route.MarkdownWrapper != NoMarkdownWrapper {
+			v.requireFile(path+".markdown_wrapper", route.MarkdownWrapper)
+		}
+	}
+	if wrapper := m.MarkdownWrapper(route); route.TemplateType == "MARKDOWN" && wrapper != "" && wrapper != NoMarkdownWrapper {
+		sources = append(sources, wrapper)
+	}
+	if routeParamPattern.MatchString(route.Path) && sourceParamPattern.MatchString(route.Source) {
+		sources = append(sources, v.dynamicSources(path, route)...)
+	} else if v.requireFile(path+".source", route.Source) {
+		sources = append(sources, route.Source)
+	}
+
+	for _, name := range v.referencedPartials(sources) {
+		if !declared[name] {
+			v.addf(path+".partial_deps", "partial %s is used but not declared in partial_deps", name)
+		}
+	}
+}
+
+// layoutChain checks that source and the layouts it is nested into exist,
+// returning them innermost first
+func (v *validator) layoutChain(path string, source string) []string {
+	if chain, ok := v.layouts[source]; ok {
+		return chain
+	}
+	if v.layouts == nil {
+		v.layouts = make(map[string][]string)
+	}
+
+	var chain []string
+	if v.requireFile(path, source) {
+		var err error
+		chain, err = LayoutChain(source)
+		if err != nil {
+			v.addf(path, "%v", err)
+		}
+	}
+	v.layouts[source] = chain
+	return chain
+}
+
+// dynamicSources lists the files a dynamic route will render, reporting
+// languages that are missing a source
+func (v *validator) dynamicSources(path string, route Route) []string {
+	dirs, err := filepath.Glob("pages" + routeParamPattern.ReplaceAllString(route.Path, "*"))
+	if err != nil {
+		v.addf(path+".path", "invalid route pattern: %v", err)
+		return nil
+	}
+
+	ext := ".plush.html"
+	if route.TemplateType == "MARKDOWN" {
+		ext = ".md"
+	}
+
+	var sources []string
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		for _, lang := range v.manifest.Languages() {
+			source := filepath.Join(dir, lang+ext)
+			if _, err := os.Stat(source); err != nil {
+				v.addf(path+".source", "missing %s for language %s", source, lang)
+				continue
+			}
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// referencedPartials returns the names of partials referenced by sources and,
+// transitively, by those partials
+func (v *validator) referencedPartials(sources []string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	queue := append([]string(nil), sources...)
+
+	for len(queue) > 0 {
+		source := queue[0]
+		queue = queue[1:]
+
+		content, err := os.ReadFile(source)
+		if err != nil {
+			continue
+		}
+		for _, match := range partialRefPattern.FindAllStringSubmatch(string(content), -1) {
+			name := match[1]
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+			if partial, ok := v.manifest.Partials[name]; ok {
+				queue = append(queue, partial.Source)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// SortedKeys returns the keys of m in sorted order, for deterministic
+// iteration over manifest maps
+func SortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// NoMarkdownWrapper disables wrapping rendered markdown pages
+const NoMarkdownWrapper = "none"
+
+// MarkdownExtension is a feature that can be turned on or off in the
+// markdown section, backed by parser extensions or HTML renderer flags
+type MarkdownExtension struct {
+	Parser   parser.Extensions
+	Renderer html.Flags
+	// Default extensions are enabled unless disabled
+	Default bool
+}
+
+// MarkdownExtensions lists the extensions by the name used in the manifest
+var MarkdownExtensions = map[string]MarkdownExtension{
+	"tables":               {Parser: parser.Tables, Default: true},
+	"fenced_code":          {Parser: parser.FencedCode, Default: true},
+	"autolink":             {Parser: parser.Autolink, Default: true},
+	"strikethrough":        {Parser: parser.Strikethrough, Default: true},
+	"no_intra_emphasis":    {Parser: parser.NoIntraEmphasis, Default: true},
+	"space_headings":       {Parser: parser.SpaceHeadings, Default: true},
+	"heading_ids":          {Parser: parser.HeadingIDs, Default: true},
+	"auto_heading_ids":     {Parser: parser.AutoHeadingIDs, Default: true},
+	"backslash_line_break": {Parser: parser.BackslashLineBreak, Default: true},
+	"definition_lists":     {Parser: parser.DefinitionLists, Default: true},
+	"math":                 {Parser: parser.MathJax, Default: true},
+	"footnotes":            {Parser: parser.Footnotes},
+	"attributes":           {Parser: parser.Attributes},
+	"super_subscript":      {Parser: parser.SuperSubscript},
+	"ordered_list_start":   {Parser: parser.OrderedListStart},
+	"smartypants": {
+		Renderer: html.Smartypants | html.SmartypantsFractions | html.SmartypantsDashes | html.SmartypantsLatexDashes,
+		Default:  true,
+	},
+	"lazy_load_images": {Renderer: html.LazyLoadImages},
+}
+
+// ExternalLinkRels maps the rel values external links can be given to their
+// renderer flags
+var ExternalLinkRels = map[string]html.Flags{
+	"nofollow":   html.NofollowLinks,
+	"noopener":   html.NoopenerLinks,
+	"noreferrer": html.NoreferrerLinks,
+}
+
+// ParserExtensions are the parser extensions enabled by the markdown section
+func (md Markdown) ParserExtensions() parser.Extensions {
+	var extensions parser.Extensions
+	for _, ext := range md.enabled() {
+		extensions |= ext.Parser
+	}
+	if md.HardLineBreaks {
+		extensions |= parser.HardLineBreak
+	}
+	return extensions
+}
+
+// RendererFlags are the HTML renderer flags enabled by the markdown section
+func (md Markdown) RendererFlags() html.Flags {
+	var flags html.Flags
+	for _, ext := range md.enabled() {
+		flags |= ext.Renderer
+	}
+	if md.ExternalLinks.NewTab {
+		flags |= html.HrefTargetBlank
+	}
+	for _, rel := range md.ExternalLinks.Rel {
+		flags |= ExternalLinkRels[rel]
+	}
+	return flags
+}
+
+func (md Markdown) enabled() []MarkdownExtension {
+	on := make(map[string]bool)
+	for name, ext := range MarkdownExtensions {
+		on[name] = ext.Default
+	}
+	for _, name := range md.Extensions {
+		on[name] = true
+	}
+	for _, name := range md.DisableExtensions {
+		on[name] = false
+	}
+
+	var enabled []MarkdownExtension
+	for name, ext := range MarkdownExtensions {
+		if on[name] {
+			enabled = append(enabled, ext)
+		}
+	}
+	return enabled
+}
+
+// MarkdownWrapper is the template a markdown route's pages are wrapped in:
+// the route's own, the markdown section's, or "" for the default <article>
+func (m *SiteManifest) MarkdownWrapper(route Route) string {
+	if route.MarkdownWrapper != "" {
+		return route.MarkdownWrapper
+	}
+	return m.Markdown.Wrapper
+}
+
+// Levels returns the heading levels listed in tables of contents
+func (t TOC) Levels() (int, int) {
+	min, max := t.MinLevel, t.MaxLevel
+	if min == 0 {
+		min = 2
+	}
+	if max == 0 {
+		max = 3
+	}
+	return min, max
+}
@@ -0,0 +1,19 @@
+package config
+
+// RoutePath returns where the terms index of the taxonomy called name is
+// served, term pages are served below it
+func (t Taxonomy) RoutePath(name string) string {
+	if t.Path != "" {
+		return t.Path
+	}
+	return "/" + name
+}
+
+// TermsKey returns the frontmatter key holding the terms of the taxonomy
+// called name
+func (t Taxonomy) TermsKey(name string) string {
+	if t.Key != "" {
+		return t.Key
+	}
+	return name
+}
@@ -19,6 +19,161 @@ type SiteManifest struct {
 	Origin             string                      `yaml:"origin"`
 	NotFoundPageSource string                      `yaml:"not_found_page_source"`
 	Partials           map[string]Partial          `yaml:"partials"`
+	I18n               I18n                        `yaml:"i18n"`
+	Sitemap            Sitemap                     `yaml:"sitemap"`
+	Robots             *Robots                     `yaml:"robots"`
+	Collections        map[string]Collection       `yaml:"collections"`
+	Taxonomies         map[string]Taxonomy         `yaml:"taxonomies"`
+	Feeds              map[string]Feed             `yaml:"feeds"`
+
+	// DefaultLayout is the layout of routes that don't set one, defaults to
+	// templates/layouts/base.plush.html
+	DefaultLayout string `yaml:"default_layout"`
+
+	Markdown Markdown `yaml:"markdown"`
+	// Shortcodes are plush templates markdown content can call as
+	// {{< name arg="value" >}}...{{< /name >}}
+	Shortcodes map[string]Shortcode `yaml:"shortcodes"`
+}
+
+type Shortcode struct {
+	Source string `yaml:"source"`
+}
+
+// Markdown configures how markdown pages and partials are rendered
+type Markdown struct {
+	// Extensions turns on extensions such as footnotes or attributes on top
+	// of the defaults, DisableExtensions turns defaults such as smartypants
+	// off
+	Extensions        []string `yaml:"extensions"`
+	DisableExtensions []string `yaml:"disable_extensions"`
+	// HardLineBreaks renders every newline inside a paragraph as a <br>
+	HardLineBreaks bool          `yaml:"hard_line_breaks"`
+	ExternalLinks  ExternalLinks `yaml:"external_links"`
+	// Wrapper is a plush template markdown pages are rendered into as yield,
+	// "none" leaves them unwrapped. Defaults to an <article>
+	Wrapper string `yaml:"wrapper"`
+	// Highlight turns on syntax highlighting of code blocks
+	Highlight *Highlight `yaml:"highlight"`
+	TOC       TOC        `yaml:"toc"`
+}
+
+// TOC picks the heading levels listed in tables of contents
+type TOC struct {
+	// MinLevel defaults to 2, leaving out the page title
+	MinLevel int `yaml:"min_level"`
+	// MaxLevel defaults to 3
+	MaxLevel int `yaml:"max_level"`
+}
+
+type Highlight struct {
+	// Theme is github or monokai, defaults to github
+	Theme string `yaml:"theme"`
+	// Style is classes, styled by a generated stylesheet, or inline.
+	// Defaults to classes
+	Style string `yaml:"style"`
+	// Path is where the stylesheet is served, defaults to /highlight.css
+	Path        string `yaml:"path"`
+	LineNumbers bool   `yaml:"line_numbers"`
+}
+
+// ExternalLinks sets attributes on links to absolute URLs
+type ExternalLinks struct {
+	// NewTab adds target="_blank"
+	NewTab bool `yaml:"new_tab"`
+	// Rel lists nofollow, noopener and noreferrer
+	Rel []string `yaml:"rel"`
+}
+
+// Feed publishes the pages of a dynamic route as RSS, Atom and JSON Feed
+// files in every language
+type Feed struct {
+	// Route is the path of the dynamic route the items come from, e.g.
+	// /blog/:slug
+	Route string `yaml:"route"`
+	// Title and Description are looked up in the translations, falling back
+	// to the text as written
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+	// Path is the directory the feed files are served from, defaults to the
+	// route's path up to its first parameter, e.g. /blog
+	Path string `yaml:"path"`
+	// Formats lists rss, atom and json, defaults to all of them
+	Formats []string `yaml:"formats"`
+	// Limit caps the number of items, newest first, defaults to 20
+	Limit int `yaml:"limit"`
+	// FullContent includes each item's rendered HTML
+	FullContent bool `yaml:"full_content"`
+	// SummaryKey is the frontmatter key used as an item's summary, defaults
+	// to description
+	SummaryKey string `yaml:"summary_key"`
+}
+
+// Taxonomy groups a collection's entries by the terms listed in their
+// frontmatter, e.g. tags, generating a page per term and an index of terms
+type Taxonomy struct {
+	Collection string `yaml:"collection"`
+	// Key is the frontmatter key holding the terms, defaults to the
+	// taxonomy's name
+	Key string `yaml:"key"`
+	// Path is where the terms index is served, term pages are served below
+	// it. Defaults to /<name>
+	Path string `yaml:"path"`
+	// TermTemplate renders each term page, IndexTemplate the list of terms.
+	// No index page is generated without an IndexTemplate
+	TermTemplate  string   `yaml:"term_template"`
+	IndexTemplate string   `yaml:"index_template"`
+	Layout        string   `yaml:"layout"`
+	PartialDeps   []string `yaml:"partial_deps"`
+}
+
+// Collection groups the pages of a dynamic route, e.g. every blog post, so
+// listing pages can query them
+type Collection struct {
+	// Route is the path of the dynamic route the entries come from, e.g.
+	// /blog/:slug
+	Route string `yaml:"route"`
+	// SortBy is the default order of entries: date, title or weight,
+	// defaults to date
+	SortBy string `yaml:"sort_by"`
+	// Order is asc or desc, defaults to desc for dates and asc otherwise
+	Order string `yaml:"order"`
+}
+
+// Robots configures the generated robots.txt, the site's sitemap is always
+// referenced from it
+type Robots struct {
+	Rules []RobotsRule `yaml:"rules"`
+	// Environments override the rules when SITE_ENV matches their name
+	Environments map[string]RobotsEnvironment `yaml:"environments"`
+}
+
+type RobotsRule struct {
+	UserAgent string   `yaml:"user_agent"`
+	Allow     []string `yaml:"allow"`
+	Disallow  []string `yaml:"disallow"`
+}
+
+type RobotsEnvironment struct {
+	// DisallowAll blocks every crawler, e.g. on staging
+	DisallowAll bool         `yaml:"disallow_all"`
+	Rules       []RobotsRule `yaml:"rules"`
+}
+
+type Sitemap struct {
+	// MaxURLs caps the number of URLs per sitemap file, defaults to the
+	// protocol limit of 50,000
+	MaxURLs int `yaml:"max_urls"`
+	// SplitBy shards the sitemap into one set of files per "language" or
+	// per "route", leave empty to only split when a file is full
+	SplitBy string `yaml:"split_by"`
+}
+
+type I18n struct {
+	DefaultLanguage string `yaml:"default_language"`
+	// UnprefixedDefaultLanguage serves the default language at the site root,
+	// e.g. /about instead of /en/about
+	UnprefixedDefaultLanguage bool `yaml:"unprefixed_default_language"`
 }
 
 type Route struct {
@@ -27,6 +182,28 @@ type Route struct {
 	TemplateType   string   `yaml:"template_type"`
 	JavascriptDeps []string `yaml:"javascript_deps"`
 	PartialDeps    []string `yaml:"partial_deps"`
+	// Layout is a layout name such as "docs" or a path, pages can override
+	// it with a layout key in their frontmatter
+	Layout string `yaml:"layout"`
+	// MarkdownWrapper overrides the markdown section's wrapper for the
+	// route's pages
+	MarkdownWrapper string `yaml:"markdown_wrapper"`
+
+	// Sitemap settings, priority and changefreq are omitted when unset
+	Priority           *float64 `yaml:"priority"`
+	ChangeFreq         string   `yaml:"changefreq"`
+	ExcludeFromSitemap bool     `yaml:"exclude_from_sitemap"`
+
+	// Paginate splits a listing route over numbered pages, e.g. /blog,
+	// /blog/page/2, /blog/page/3
+	Paginate *Paginate `yaml:"paginate"`
+}
+
+type Paginate struct {
+	// Collection is the collection listed by the route
+	Collection string `yaml:"collection"`
+	// PerPage defaults to 10
+	PerPage int `yaml:"per_page"`
 }
 
 type Translation struct {
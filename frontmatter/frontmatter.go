@@ -0,0 +1,237 @@
+package frontmatter
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Format is the syntax of a frontmatter block
+type Format string
+
+const (
+	YAML Format = "YAML"
+	TOML Format = "TOML"
+	JSON Format = "JSON"
+)
+
+// Document is a source file split into its frontmatter and body
+type Document struct {
+	// Format is empty when the file has no frontmatter
+	Format Format
+	Params map[string]interface{}
+	Body   string
+	// BodyLine is the line of the file Body starts on
+	BodyLine int
+}
+
+// Error is a malformed frontmatter block, Line is the line of the file the
+// problem was found on
+type Error struct {
+	Format  Format
+	Line    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: invalid %s frontmatter: %s", e.Line, e.Format, e.Message)
+}
+
+var (
+	yamlLineRe = regexp.MustCompile(`line (\d+): `)
+	// legacyKeyRe matches the first line of an unfenced YAML block
+	legacyKeyRe = regexp.MustCompile(`^[A-Za-z_][\w-]*:(\s|$)`)
+	// jsonStartRe matches the first line of a JSON object, a lone { or a {
+	// followed by a key, so {{ shortcodes and template tags aren't JSON
+	jsonStartRe = regexp.MustCompile(`^\{\s*("|$)`)
+)
+
+// Parse splits content into frontmatter and body. Frontmatter is optional
+// and may be a YAML block fenced by ---, a TOML block fenced by +++ or a
+// JSON object at the start of the file. For compatibility a YAML block with
+// no opening fence, closed by a --- line, is also accepted when the file
+// starts with a key and the block decodes to a mapping
+func Parse(content []byte) (*Document, error) {
+	text := strings.TrimPrefix(string(content), "\uFEFF")
+	first, _, _ := strings.Cut(text, "\n")
+	first = strings.TrimRight(first, " \t\r")
+
+	switch {
+	case first == "---":
+		return parseFenced(text, YAML, "---")
+	case first == "+++":
+		return parseFenced(text, TOML, "+++")
+	case jsonStartRe.MatchString(first):
+		return parseJSON(text)
+	case legacyKeyRe.MatchString(first):
+		return parseLegacy(text)
+	}
+
+	return &Document{Params: map[string]interface{}{}, Body: text, BodyLine: 1}, nil
+}
+
+// parseFenced parses a block opened and closed by fence lines
+func parseFenced(text string, format Format, fence string) (*Document, error) {
+	lines := strings.SplitAfter(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t\r\n")
+		if line != fence && !(format == YAML && line == "...") {
+			continue
+		}
+
+		block := strings.Join(lines[1:i], "")
+		params, err := decode(format, block, 2)
+		if err != nil {
+			return nil, err
+		}
+		return &Document{
+			Format:   format,
+			Params:   params,
+			Body:     strings.Join(lines[i+1:], ""),
+			BodyLine: i + 2,
+		}, nil
+	}
+
+	return nil, &Error{Format: format, Line: 1, Message: fmt.Sprintf("missing closing %s", fence)}
+}
+
+// parseLegacy parses an unfenced YAML block closed by a --- line
+func parseLegacy(text string) (*Document, error) {
+	lines := strings.SplitAfter(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimRight(lines[i], " \t\r\n") != "---" {
+			continue
+		}
+
+		// Body text that happens to start like a key, followed by a
+		// horizontal rule, isn't frontmatter
+		params, err := decode(YAML, strings.Join(lines[:i], ""), 1)
+		if err != nil {
+			break
+		}
+		return &Document{
+			Format:   YAML,
+			Params:   params,
+			Body:     strings.Join(lines[i+1:], ""),
+			BodyLine: i + 2,
+		}, nil
+	}
+
+	return &Document{Params: map[string]interface{}{}, Body: text, BodyLine: 1}, nil
+}
+
+// parseJSON parses a JSON object at the start of text, the body starts on
+// the line after the closing brace
+func parseJSON(text string) (*Document, error) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	var params map[string]interface{}
+	err := dec.Decode(&params)
+	if err != nil {
+		line := 1
+		switch e := err.(type) {
+		case *json.SyntaxError:
+			line = lineAt(text, e.Offset)
+		case *json.UnmarshalTypeError:
+			line = lineAt(text, e.Offset)
+		}
+		return nil, &Error{Format: JSON, Line: line, Message: err.Error()}
+	}
+
+	end := int(dec.InputOffset())
+	rest := text[end:]
+	if i := strings.Index(rest, "\n"); i != -1 {
+		if strings.TrimSpace(rest[:i]) != "" {
+			return nil, &Error{Format: JSON, Line: lineAt(text, int64(end)), Message: "unexpected content after closing }"}
+		}
+		end += i + 1
+	} else {
+		end = len(text)
+	}
+
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	return &Document{
+		Format:   JSON,
+		Params:   params,
+		Body:     text[end:],
+		BodyLine: lineAt(text, int64(end)),
+	}, nil
+}
+
+// decode parses a block that starts on line offset of the file
+func decode(format Format, block string, offset int) (map[string]interface{}, error) {
+	switch format {
+	case YAML:
+		var params map[string]interface{}
+		err := yaml.Unmarshal([]byte(block), &params)
+		if err != nil {
+			return nil, yamlError(err, offset)
+		}
+		if params == nil {
+			params = map[string]interface{}{}
+		}
+		normalize(params)
+		return params, nil
+	case TOML:
+		params, err := parseTOML(block)
+		if err != nil {
+			if e, ok := err.(*Error); ok {
+				e.Line += offset - 1
+			}
+			return nil, err
+		}
+		return params, nil
+	}
+	return nil, fmt.Errorf("unsupported frontmatter format %s", format)
+}
+
+// yamlError rewrites yaml.v2 line numbers, which are relative to the block,
+// to lines of the file
+func yamlError(err error, offset int) error {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	line := offset
+	if m := yamlLineRe.FindStringSubmatch(msg); m != nil {
+		var n int
+		fmt.Sscanf(m[1], "%d", &n)
+		line = n + offset - 1
+		msg = strings.Replace(msg, m[0], "", 1)
+	}
+	msg = strings.TrimSpace(strings.TrimPrefix(msg, "unmarshal errors:"))
+	return &Error{Format: YAML, Line: line, Message: msg}
+}
+
+func lineAt(text string, offset int64) int {
+	if offset > int64(len(text)) {
+		offset = int64(len(text))
+	}
+	return strings.Count(text[:offset], "\n") + 1
+}
+
+// normalize converts the map[interface{}]interface{} values yaml.v2 decodes
+// nested mappings into, so templates only ever see string keyed maps
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = normalize(val)
+		}
+		return m
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = normalize(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = normalize(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
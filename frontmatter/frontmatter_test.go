@@ -0,0 +1,112 @@
+package frontmatter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLegacy(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		format   Format
+		params   map[string]interface{}
+		body     string
+		bodyLine int
+	}{
+		{
+			name:     "unfenced block",
+			content:  "title: Hello\ndraft: true\n---\nBody\n",
+			format:   YAML,
+			params:   map[string]interface{}{"title": "Hello", "draft": true},
+			body:     "Body\n",
+			bodyLine: 4,
+		},
+		{
+			name:     "prose followed by a rule",
+			content:  "Note: this is prose\n\nMore prose here.\n---\nAfter the rule\n",
+			params:   map[string]interface{}{},
+			body:     "Note: this is prose\n\nMore prose here.\n---\nAfter the rule\n",
+			bodyLine: 1,
+		},
+		{
+			name:     "prose that isn't a mapping",
+			content:  "Warning: a: b\n---\n",
+			params:   map[string]interface{}{},
+			body:     "Warning: a: b\n---\n",
+			bodyLine: 1,
+		},
+		{
+			name:     "key without a rule",
+			content:  "Note: no rule follows\n",
+			params:   map[string]interface{}{},
+			body:     "Note: no rule follows\n",
+			bodyLine: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse([]byte(tt.content))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if doc.Format != tt.format {
+				t.Errorf("Format = %q, want %q", doc.Format, tt.format)
+			}
+			if !reflect.DeepEqual(doc.Params, tt.params) {
+				t.Errorf("Params = %#v, want %#v", doc.Params, tt.params)
+			}
+			if doc.Body != tt.body {
+				t.Errorf("Body = %q, want %q", doc.Body, tt.body)
+			}
+			if doc.BodyLine != tt.bodyLine {
+				t.Errorf("BodyLine = %d, want %d", doc.BodyLine, tt.bodyLine)
+			}
+		})
+	}
+}
+
+// Only a lone { or one followed by a key starts JSON frontmatter
+func TestParseJSONFirstLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		format   Format
+		body     string
+		bodyLine int
+	}{
+		{"shortcode", "{{< callout type=\"warning\" >}}\nCareful\n{{< /callout >}}\n", "", "{{< callout type=\"warning\" >}}\nCareful\n{{< /callout >}}\n", 1},
+		{"template tag", "{{ .Title }}\n", "", "{{ .Title }}\n", 1},
+		{"object with a key", "{\"title\": \"Hello\"}\nBody\n", JSON, "Body\n", 2},
+		{"object on its own line", "{\n  \"title\": \"Hello\"\n}\nBody\n", JSON, "Body\n", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse([]byte(tt.content))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if doc.Format != tt.format {
+				t.Errorf("Format = %q, want %q", doc.Format, tt.format)
+			}
+			if doc.Body != tt.body || doc.BodyLine != tt.bodyLine {
+				t.Errorf("Body = %q on line %d, want %q on line %d", doc.Body, doc.BodyLine, tt.body, tt.bodyLine)
+			}
+		})
+	}
+}
+
+func TestParseFencedBodyRule(t *testing.T) {
+	doc, err := Parse([]byte("---\ntitle: Hello\n---\nIntro\n\n---\n\nMore\n"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if doc.Body != "Intro\n\n---\n\nMore\n" {
+		t.Errorf("Body = %q", doc.Body)
+	}
+	if doc.BodyLine != 4 {
+		t.Errorf("BodyLine = %d, want 4", doc.BodyLine)
+	}
+}
@@ -0,0 +1,608 @@
+package frontmatter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tomlDateLayouts are the TOML date and date-time forms, local times are
+// parsed as UTC
+var tomlDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// tomlParser decodes the subset of TOML used for frontmatter: key/value
+// pairs with bare, quoted and dotted keys, tables, arrays of tables, strings,
+// numbers, booleans, dates, arrays and inline tables
+type tomlParser struct {
+	src   string
+	pos   int
+	line  int
+	root  map[string]interface{}
+	table map[string]interface{}
+	// defined tracks explicitly declared tables to catch redefinitions
+	defined map[string]bool
+}
+
+func parseTOML(src string) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	p := &tomlParser{src: src, line: 1, root: root, table: root, defined: make(map[string]bool)}
+	err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return p.errorAt(p.line, format, args...)
+}
+
+// errorAt reports a problem with a value that started on an earlier line,
+// such as an unterminated multi-line string
+func (p *tomlParser) errorAt(line int, format string, args ...interface{}) error {
+	return &Error{Format: TOML, Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *tomlParser) hasPrefix(s string) bool {
+	return strings.HasPrefix(p.src[p.pos:], s)
+}
+
+func (p *tomlParser) advance(n int) {
+	for i := 0; i < n && !p.eof(); i++ {
+		if p.src[p.pos] == '\n' {
+			p.line++
+		}
+		p.pos++
+	}
+}
+
+// skipSpace skips spaces and tabs on the current line
+func (p *tomlParser) skipSpace() {
+	for c := p.peek(); c == ' ' || c == '\t'; c = p.peek() {
+		p.advance(1)
+	}
+}
+
+// skipBlank skips whitespace, newlines and comments
+func (p *tomlParser) skipBlank() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\r', '\n':
+			p.advance(1)
+		case '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) skipComment() {
+	for !p.eof() && p.peek() != '\n' {
+		p.advance(1)
+	}
+}
+
+// endLine requires the rest of the line to be blank or a comment
+func (p *tomlParser) endLine() error {
+	p.skipSpace()
+	if p.peek() == '#' {
+		p.skipComment()
+	}
+	if p.peek() == '\r' {
+		p.advance(1)
+	}
+	if p.eof() || p.peek() == '\n' {
+		p.advance(1)
+		return nil
+	}
+	return p.errorf("unexpected %q after value", p.peek())
+}
+
+func (p *tomlParser) parse() error {
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return nil
+		}
+
+		var err error
+		if p.hasPrefix("[[") {
+			err = p.parseArrayTable()
+		} else if p.peek() == '[' {
+			err = p.parseTable()
+		} else {
+			err = p.parseKeyValue(p.table)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = p.endLine()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (p *tomlParser) parseTable() error {
+	p.advance(1)
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if p.peek() != ']' {
+		return p.errorf("expected ] to close table header")
+	}
+	p.advance(1)
+
+	name := strings.Join(keys, ".")
+	if p.defined[name] {
+		return p.errorf("table [%s] is defined more than once", name)
+	}
+	p.defined[name] = true
+
+	table, err := p.descend(p.root, keys)
+	if err != nil {
+		return err
+	}
+	p.table = table
+	return nil
+}
+
+func (p *tomlParser) parseArrayTable() error {
+	p.advance(2)
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if !p.hasPrefix("]]") {
+		return p.errorf("expected ]] to close array of tables header")
+	}
+	p.advance(2)
+
+	parent, err := p.descend(p.root, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+
+	table := make(map[string]interface{})
+	switch existing := parent[last].(type) {
+	case nil:
+		parent[last] = []interface{}{table}
+	case []interface{}:
+		parent[last] = append(existing, table)
+	default:
+		return p.errorf("key %s is already defined", strings.Join(keys, "."))
+	}
+	p.table = table
+	return nil
+}
+
+// descend walks keys from table, creating missing tables. Arrays of tables
+// resolve to their last element
+func (p *tomlParser) descend(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	return p.descendAt(table, keys, p.line)
+}
+
+// descendAt is descend reporting problems on line
+func (p *tomlParser) descendAt(table map[string]interface{}, keys []string, line int) (map[string]interface{}, error) {
+	for i, key := range keys {
+		switch existing := table[key].(type) {
+		case nil:
+			next := make(map[string]interface{})
+			table[key] = next
+			table = next
+		case map[string]interface{}:
+			table = existing
+		case []interface{}:
+			last, ok := lastTable(existing)
+			if !ok {
+				return nil, p.errorAt(line, "key %s is not a table", strings.Join(keys[:i+1], "."))
+			}
+			table = last
+		default:
+			return nil, p.errorAt(line, "key %s is not a table", strings.Join(keys[:i+1], "."))
+		}
+	}
+	return table, nil
+}
+
+func lastTable(items []interface{}) (map[string]interface{}, bool) {
+	if len(items) == 0 {
+		return nil, false
+	}
+	m, ok := items[len(items)-1].(map[string]interface{})
+	return m, ok
+}
+
+func (p *tomlParser) parseKeyValue(table map[string]interface{}) error {
+	p.skipSpace()
+	line := p.line
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if p.peek() != '=' {
+		return p.errorf("expected = after key %s", strings.Join(keys, "."))
+	}
+	p.advance(1)
+	p.skipSpace()
+
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	// Values may span lines, problems with the key are reported on its line
+	parent, err := p.descendAt(table, keys[:len(keys)-1], line)
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, ok := parent[last]; ok {
+		return p.errorAt(line, "duplicate key %s", strings.Join(keys, "."))
+	}
+	parent[last] = value
+	return nil
+}
+
+// parseKey parses a possibly dotted key and the whitespace after it
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace()
+		var key string
+		var err error
+		switch p.peek() {
+		case '"':
+			key, err = p.parseBasicString()
+		case '\'':
+			key, err = p.parseLiteralString()
+		default:
+			start := p.pos
+			for c := p.peek(); isBareKeyChar(c); c = p.peek() {
+				p.advance(1)
+			}
+			key = p.src[start:p.pos]
+			if key == "" {
+				return nil, p.errorf("expected a key")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+
+		p.skipSpace()
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.advance(1)
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) parseValue() (interface{}, error) {
+	switch {
+	case p.hasPrefix(`"""`):
+		return p.parseMultilineBasicString()
+	case p.hasPrefix(`'''`):
+		return p.parseMultilineLiteralString()
+	case p.peek() == '"':
+		return p.parseBasicString()
+	case p.peek() == '\'':
+		return p.parseLiteralString()
+	case p.peek() == '[':
+		return p.parseArray()
+	case p.peek() == '{':
+		return p.parseInlineTable()
+	case p.eof() || p.peek() == '\n' || p.peek() == '\r' || p.peek() == '#':
+		return nil, p.errorf("missing value")
+	}
+	return p.parseScalar()
+}
+
+func (p *tomlParser) parseArray() (interface{}, error) {
+	line := p.line
+	p.advance(1)
+	items := []interface{}{}
+	for {
+		p.skipBlank()
+		if p.peek() == ']' {
+			p.advance(1)
+			return items, nil
+		}
+		if p.eof() {
+			return nil, p.errorAt(line, "unterminated array")
+		}
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.advance(1)
+		case ']':
+		default:
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable() (interface{}, error) {
+	p.advance(1)
+	table := make(map[string]interface{})
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.advance(1)
+		return table, nil
+	}
+	for {
+		err := p.parseKeyValue(table)
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.advance(1)
+		case '}':
+			p.advance(1)
+			return table, nil
+		default:
+			return nil, p.errorf("expected , or } in inline table")
+		}
+	}
+}
+
+func (p *tomlParser) parseBasicString() (string, error) {
+	p.advance(1)
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		if c == '"' {
+			p.advance(1)
+			return b.String(), nil
+		}
+		if c == '\\' {
+			err := p.parseEscape(&b)
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		b.WriteByte(c)
+		p.advance(1)
+	}
+}
+
+func (p *tomlParser) parseMultilineBasicString() (string, error) {
+	line := p.line
+	p.advance(3)
+	p.trimLeadingNewline()
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorAt(line, "unterminated multi-line string")
+		}
+		if p.hasPrefix(`"""`) {
+			p.advance(3)
+			return b.String(), nil
+		}
+		c := p.peek()
+		if c == '\\' {
+			// A backslash at the end of a line trims the newline and
+			// leading whitespace of the next one
+			rest := strings.TrimLeft(p.src[p.pos+1:], " \t\r")
+			if strings.HasPrefix(rest, "\n") {
+				p.advance(1)
+				for c := p.peek(); c == ' ' || c == '\t' || c == '\r' || c == '\n'; c = p.peek() {
+					p.advance(1)
+				}
+				continue
+			}
+			err := p.parseEscape(&b)
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		b.WriteByte(c)
+		p.advance(1)
+	}
+}
+
+func (p *tomlParser) parseLiteralString() (string, error) {
+	p.advance(1)
+	start := p.pos
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		if p.peek() == '\'' {
+			s := p.src[start:p.pos]
+			p.advance(1)
+			return s, nil
+		}
+		p.advance(1)
+	}
+}
+
+func (p *tomlParser) parseMultilineLiteralString() (string, error) {
+	line := p.line
+	p.advance(3)
+	p.trimLeadingNewline()
+	start := p.pos
+	for {
+		if p.eof() {
+			return "", p.errorAt(line, "unterminated multi-line string")
+		}
+		if p.hasPrefix(`'''`) {
+			s := p.src[start:p.pos]
+			p.advance(3)
+			return s, nil
+		}
+		p.advance(1)
+	}
+}
+
+func (p *tomlParser) trimLeadingNewline() {
+	if p.hasPrefix("\r\n") {
+		p.advance(2)
+	} else if p.peek() == '\n' {
+		p.advance(1)
+	}
+}
+
+func (p *tomlParser) parseEscape(b *strings.Builder) error {
+	p.advance(1)
+	c := p.peek()
+	p.advance(1)
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case '"':
+		b.WriteByte('"')
+	case '\\':
+		b.WriteByte('\\')
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.src) {
+			return p.errorf("invalid unicode escape")
+		}
+		n, err := strconv.ParseUint(p.src[p.pos:p.pos+size], 16, 32)
+		if err != nil {
+			return p.errorf("invalid unicode escape \\%c%s", c, p.src[p.pos:p.pos+size])
+		}
+		b.WriteRune(rune(n))
+		p.advance(size)
+	default:
+		return p.errorf("invalid escape sequence \\%c", c)
+	}
+	return nil
+}
+
+// parseScalar parses booleans, numbers and dates
+func (p *tomlParser) parseScalar() (interface{}, error) {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if c == ',' || c == ']' || c == '}' || c == '#' || c == '\n' || c == '\r' || c == '\t' {
+			break
+		}
+		if c == ' ' {
+			// Dates may separate the time with a space: 1979-05-27 07:32:00
+			token := p.src[start:p.pos]
+			if len(token) == 10 && token[4] == '-' && p.pos+1 < len(p.src) && isDigit(p.src[p.pos+1]) {
+				p.advance(1)
+				continue
+			}
+			break
+		}
+		p.advance(1)
+	}
+	token := p.src[start:p.pos]
+
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan", "+nan", "-nan":
+		return math.NaN(), nil
+	}
+
+	clean := strings.ReplaceAll(token, "_", "")
+	if n, ok := parseTOMLInt(clean); ok {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(clean, 64); err == nil && !hasLeadingZero(clean) {
+		return f, nil
+	}
+
+	date := strings.Replace(token, " ", "T", 1)
+	for _, layout := range tomlDateLayouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t, nil
+		}
+	}
+	// Local times have no date, keep them as written
+	if _, err := time.Parse("15:04:05.999999999", token); err == nil {
+		return token, nil
+	}
+
+	return nil, p.errorf("invalid value %q", token)
+}
+
+// parseTOMLInt parses decimal integers without leading zeros and unsigned
+// 0x, 0o and 0b prefixed integers
+func parseTOMLInt(s string) (int64, bool) {
+	digits := strings.TrimLeft(s, "+-")
+	if len(digits) > 1 && digits[0] == '0' {
+		prefixed := digits[1] == 'x' || digits[1] == 'o' || digits[1] == 'b'
+		if !prefixed || digits != s {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// hasLeadingZero reports numbers like 01 or 0x1p2 that TOML doesn't allow
+// as floats
+func hasLeadingZero(s string) bool {
+	digits := strings.TrimLeft(s, "+-")
+	return len(digits) > 1 && digits[0] == '0' && digits[1] != '.' && digits[1] != 'e' && digits[1] != 'E'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,359 @@
+package frontmatter
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want map[string]interface{}
+	}{
+		{
+			name: "scalars",
+			src: `title = "Hello"
+literal = 'C:\path'
+count = 42
+big = 1_000
+hex = 0xff
+oct = 0o17
+bin = 0b101
+negative = -7
+ratio = 0.5
+exp = 1e3
+draft = true
+published = false
+`,
+			want: map[string]interface{}{
+				"title":     "Hello",
+				"literal":   `C:\path`,
+				"count":     int64(42),
+				"big":       int64(1000),
+				"hex":       int64(255),
+				"oct":       int64(15),
+				"bin":       int64(5),
+				"negative":  int64(-7),
+				"ratio":     0.5,
+				"exp":       1000.0,
+				"draft":     true,
+				"published": false,
+			},
+		},
+		{
+			name: "escapes",
+			src:  `s = "tab\there \"quoted\" \u00e9 \U0001F600 back\\slash"`,
+			want: map[string]interface{}{"s": "tab\there \"quoted\" é 😀 back\\slash"},
+		},
+		{
+			name: "comments and blank lines",
+			src:  "# leading comment\n\ntitle = \"Hello\" # trailing comment\n\n",
+			want: map[string]interface{}{"title": "Hello"},
+		},
+		{
+			name: "quoted and dotted keys",
+			src: `"quoted key" = 1
+'literal key' = 2
+site.name = "Docs"
+site . owner = "me"
+`,
+			want: map[string]interface{}{
+				"quoted key":  int64(1),
+				"literal key": int64(2),
+				"site":        map[string]interface{}{"name": "Docs", "owner": "me"},
+			},
+		},
+		{
+			name: "tables",
+			src: `title = "Root"
+
+[author]
+name = "Ada"
+
+[author.social]
+github = "ada"
+
+[seo]
+noindex = true
+`,
+			want: map[string]interface{}{
+				"title": "Root",
+				"author": map[string]interface{}{
+					"name":   "Ada",
+					"social": map[string]interface{}{"github": "ada"},
+				},
+				"seo": map[string]interface{}{"noindex": true},
+			},
+		},
+		{
+			name: "arrays of tables",
+			src: `[[links]]
+title = "One"
+
+[[links]]
+title = "Two"
+
+[links.meta]
+rel = "nofollow"
+
+[[links]]
+title = "Three"
+`,
+			want: map[string]interface{}{
+				"links": []interface{}{
+					map[string]interface{}{"title": "One"},
+					map[string]interface{}{
+						"title": "Two",
+						"meta":  map[string]interface{}{"rel": "nofollow"},
+					},
+					map[string]interface{}{"title": "Three"},
+				},
+			},
+		},
+		{
+			name: "nested arrays of tables",
+			src: `[[series]]
+name = "Go"
+[[series.parts]]
+n = 1
+[[series.parts]]
+n = 2
+`,
+			want: map[string]interface{}{
+				"series": []interface{}{
+					map[string]interface{}{
+						"name": "Go",
+						"parts": []interface{}{
+							map[string]interface{}{"n": int64(1)},
+							map[string]interface{}{"n": int64(2)},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "arrays",
+			src: `tags = ["go", "web"]
+empty = []
+nested = [[1, 2], ["a"]]
+multiline = [
+  "one", # first
+  "two",
+]
+`,
+			want: map[string]interface{}{
+				"tags":      []interface{}{"go", "web"},
+				"empty":     []interface{}{},
+				"nested":    []interface{}{[]interface{}{int64(1), int64(2)}, []interface{}{"a"}},
+				"multiline": []interface{}{"one", "two"},
+			},
+		},
+		{
+			name: "inline tables",
+			src: `hero = { image = "/a.png", alt = "A", size.width = 640 }
+empty = {}
+cards = [{ title = "One" }, { title = "Two", tags = ["x"] }]
+`,
+			want: map[string]interface{}{
+				"hero": map[string]interface{}{
+					"image": "/a.png",
+					"alt":   "A",
+					"size":  map[string]interface{}{"width": int64(640)},
+				},
+				"empty": map[string]interface{}{},
+				"cards": []interface{}{
+					map[string]interface{}{"title": "One"},
+					map[string]interface{}{"title": "Two", "tags": []interface{}{"x"}},
+				},
+			},
+		},
+		{
+			name: "multiline strings",
+			src: `basic = """
+Roses are red
+Violets are \"blue\""""
+trimmed = """\
+  The quick \
+  brown fox."""
+literal = '''
+C:\raw\path
+  kept as is'''
+after = 1
+`,
+			want: map[string]interface{}{
+				"basic":   "Roses are red\nViolets are \"blue\"",
+				"trimmed": "The quick brown fox.",
+				"literal": "C:\\raw\\path\n  kept as is",
+				"after":   int64(1),
+			},
+		},
+		{
+			name: "dates",
+			src: `offset = 1979-05-27T07:32:00Z
+zoned = 1979-05-27T00:32:00.999-07:00
+local = 1979-05-27T07:32:00
+spaced = 1979-05-27 07:32:00
+day = 1979-05-27
+clock = 07:32:00
+`,
+			want: map[string]interface{}{
+				"offset": time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC),
+				"zoned":  time.Date(1979, 5, 27, 0, 32, 0, 999000000, time.FixedZone("", -7*60*60)),
+				"local":  time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC),
+				"spaced": time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC),
+				"day":    time.Date(1979, 5, 27, 0, 0, 0, 0, time.UTC),
+				"clock":  "07:32:00",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML(tt.src)
+			if err != nil {
+				t.Fatalf("parseTOML: %v", err)
+			}
+			if !tomlEqual(got, tt.want) {
+				t.Errorf("parseTOML =\n%#v\nwant\n%#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLSpecialFloats(t *testing.T) {
+	got, err := parseTOML("a = inf\nb = -inf\nc = nan\n")
+	if err != nil {
+		t.Fatalf("parseTOML: %v", err)
+	}
+	if !math.IsInf(got["a"].(float64), 1) || !math.IsInf(got["b"].(float64), -1) || !math.IsNaN(got["c"].(float64)) {
+		t.Errorf("parseTOML = %#v", got)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		line    int
+		message string
+	}{
+		{"missing equals", "title \"x\"", 1, "expected = after key title"},
+		{"missing value", "a = 1\ntitle =\n", 2, "missing value"},
+		{"invalid value", "a = 1\n\nb = nope\n", 3, `invalid value "nope"`},
+		{"leading zero", "n = 012", 1, `invalid value "012"`},
+		{"trailing content", "a = 1 2", 1, `unexpected '2' after value`},
+		{"duplicate key", "a = 1\nb = 2\na = 3\n", 3, "duplicate key a"},
+		{"duplicate dotted key", "site.name = 1\nsite.name = 2\n", 2, "duplicate key site.name"},
+		{"duplicate key after multiline string", "a = 1\na = \"\"\"\nx\ny\"\"\"\n", 2, "duplicate key a"},
+		{"table defined twice", "[a]\nx = 1\n[b]\n[a]\n", 4, "table [a] is defined more than once"},
+		{"key is not a table", "a = 1\n[a.b]\n", 2, "key a is not a table"},
+		{"array of tables over a value", "a = 1\n[[a]]\n", 2, "key a is already defined"},
+		{"unterminated string", "a = 1\ns = \"open\n", 2, "unterminated string"},
+		{"unterminated multiline string", "s = \"\"\"\nopen\n\nstill open", 1, "unterminated multi-line string"},
+		{"unterminated array", "a = [1,\n2,\n", 1, "unterminated array"},
+		{"unterminated literal multiline string", "a = 1\ns = '''\nopen", 2, "unterminated multi-line string"},
+		{"nested table under a value after multiline string", "a = 1\na.b = \"\"\"\nx\"\"\"\n", 2, "key a is not a table"},
+		{"array separator", "a = [1 2]", 1, "expected , or ] in array"},
+		{"inline table separator", "a = { b = 1 c = 2 }", 1, "expected , or } in inline table"},
+		{"invalid escape", "a = 1\ns = \"\\q\"\n", 2, `invalid escape sequence \q`},
+		{"invalid unicode escape", "s = \"\\uZZZZ\"", 1, `invalid unicode escape \uZZZZ`},
+		{"unclosed table header", "[a\nb = 1\n", 1, "expected ] to close table header"},
+		{"unclosed array of tables header", "[[a]\n", 1, "expected ]] to close array of tables header"},
+		{"empty key", "= 1", 1, "expected a key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML(tt.src)
+			e, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("parseTOML error = %v, want *Error", err)
+			}
+			if e.Format != TOML || e.Line != tt.line || e.Message != tt.message {
+				t.Errorf("parseTOML error = %s line %d: %q, want line %d: %q", e.Format, e.Line, e.Message, tt.line, tt.message)
+			}
+		})
+	}
+}
+
+// Errors are reported against lines of the file, after the opening +++
+func TestParseTOMLFrontmatterLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		line    int
+	}{
+		{"first key", "+++\ntitle =\n+++\nBody\n", 2},
+		{"after a table", "+++\ntitle = \"x\"\n\n[author]\nname = nope\n+++\n", 5},
+		{"after a multiline string", "+++\nsummary = \"\"\"\none\ntwo\"\"\"\ndate = 2024-13-45\n+++\n", 5},
+		{"after a BOM", "\uFEFF+++\na = 1\na = 2\n+++\n", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.content))
+			e, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("Parse error = %v, want *Error", err)
+			}
+			if e.Line != tt.line {
+				t.Errorf("Parse error line = %d (%s), want %d", e.Line, e.Message, tt.line)
+			}
+		})
+	}
+}
+
+func TestParseTOMLFrontmatter(t *testing.T) {
+	doc, err := Parse([]byte("+++\ntitle = \"Hello\"\ntags = [\"go\"]\n+++\nBody\n"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := map[string]interface{}{"title": "Hello", "tags": []interface{}{"go"}}
+	if doc.Format != TOML || !tomlEqual(doc.Params, want) {
+		t.Errorf("Parse = %s %#v, want TOML %#v", doc.Format, doc.Params, want)
+	}
+	if doc.Body != "Body\n" || doc.BodyLine != 5 {
+		t.Errorf("Body = %q on line %d, want %q on line 5", doc.Body, doc.BodyLine, "Body\n")
+	}
+}
+
+// tomlEqual compares decoded values, times by instant and offset since
+// time.Time holds a location pointer
+func tomlEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if !tomlEqual(v, b[k]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !tomlEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case time.Time:
+		b, ok := b.(time.Time)
+		if !ok || !a.Equal(b) {
+			return false
+		}
+		_, ao := a.Zone()
+		_, bo := b.Zone()
+		return ao == bo
+	}
+	return reflect.DeepEqual(a, b)
+}
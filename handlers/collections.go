@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ZacxDev/go-static-site/config"
+	"github.com/gobuffalo/plush"
+	"github.com/pkg/errors"
+)
+
+// Entry is a page of a collection as exposed to templates, its frontmatter
+// is reachable through the embedded PageMeta, e.g. entry.Title or
+// entry.FormatDate("date", "Jan 2, 2006")
+type Entry struct {
+	*PageMeta
+	Collection string
+	Lang       string
+	// URL is the site relative path of the entry, Permalink the absolute URL
+	URL       string
+	Permalink string
+	Source    string
+	// RouteParams are the entry's path parameters, e.g. slug
+	RouteParams map[string]string
+}
+
+// Entries is an ordered list of collection entries. Its query methods return
+// new lists, templates reach them through helpers such as
+// limit(where(collection("blog"), "featured", true), 3) since Plush can't
+// call methods on the result of a call
+type Entries []*Entry
+
+// EntryGroup is a set of entries sharing a value, see Entries.GroupBy
+type EntryGroup struct {
+	Key     string
+	Entries Entries
+}
+
+// loadCollections builds every collection in the manifest from the site's
+// pages, reading each entry's frontmatter
+func loadCollections(manifest *config.SiteManifest, pages []PageRoute) (map[string]Entries, error) {
+	collections := make(map[string]Entries, len(manifest.Collections))
+
+	for name, collection := range manifest.Collections {
+		entries, err := collectEntries(manifest, pages, collection.Route, name)
+		if err != nil {
+			return nil, err
+		}
+
+		sortBy := collection.SortBy
+		if sortBy == "" {
+			sortBy = "date"
+		}
+		order := collection.Order
+		if order == "" {
+			order = "asc"
+			if sortBy == "date" {
+				order = "desc"
+			}
+		}
+		collections[name] = entries.SortBy(sortBy, order)
+	}
+
+	return collections, nil
+}
+
+// collectEntries reads the entries of every page expanded from the dynamic
+// route at pattern, in page order
+func collectEntries(manifest *config.SiteManifest, pages []PageRoute, pattern string, collection string) (Entries, error) {
+	entries := Entries{}
+	for _, page := range pages {
+		// Skip the unprefixed aliases of default language pages
+		url := manifest.LocalizedPath(page.Lang, page.Route.Path)
+		if page.Pattern != pattern || page.URLPath != url {
+			continue
+		}
+
+		content, _, err := templates.readFile(page.Route.Source)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		doc, err := parseFrontmatter(page.Route.Source, content)
+		if err != nil {
+			return nil, err
+		}
+
+		params := make(map[string]string, len(page.Params))
+		for k, v := range page.Params {
+			if k != "lang" {
+				params[k] = v
+			}
+		}
+
+		entries = append(entries, &Entry{
+			PageMeta:    NewPageMeta(doc.Params),
+			Collection:  collection,
+			Lang:        page.Lang,
+			URL:         url,
+			Permalink:   manifest.URL(url),
+			Source:      page.Route.Source,
+			RouteParams: params,
+		})
+	}
+	return entries, nil
+}
+
+// setCollectionHelpers adds the entry query helpers to ctx
+func setCollectionHelpers(ctx *plush.Context) {
+	ctx.Set("where", Entries.Where)
+	ctx.Set("whereHas", Entries.Has)
+	ctx.Set("inLang", Entries.Lang)
+	ctx.Set("sortBy", Entries.SortBy)
+	ctx.Set("limit", Entries.Limit)
+	ctx.Set("offset", Entries.Offset)
+	ctx.Set("groupBy", Entries.GroupBy)
+	ctx.Set("groupByDate", Entries.GroupByDate)
+}
+
+// Len returns the number of entries
+func (e Entries) Len() int {
+	return len(e)
+}
+
+// First returns the first entry, or nil when there are none
+func (e Entries) First() *Entry {
+	if len(e) == 0 {
+		return nil
+	}
+	return e[0]
+}
+
+// Lang keeps the entries in the given language
+func (e Entries) Lang(lang string) Entries {
+	out := Entries{}
+	for _, entry := range e {
+		if entry.Lang == lang {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+// Where keeps the entries whose frontmatter value at key equals value, list
+// values match when they contain it
+func (e Entries) Where(key string, value interface{}) Entries {
+	want := fmt.Sprint(value)
+	out := Entries{}
+	for _, entry := range e {
+		v := entry.Get(key)
+		if list, ok := v.([]interface{}); ok {
+			for _, item := range list {
+				if fmt.Sprint(item) == want {
+					out = append(out, entry)
+					break
+				}
+			}
+			continue
+		}
+		if v != nil && fmt.Sprint(v) == want {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+// Has keeps the entries that set key in their frontmatter
+func (e Entries) Has(key string) Entries {
+	out := Entries{}
+	for _, entry := range e {
+		if entry.PageMeta.Has(key) {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+// SortBy orders entries by a frontmatter value, "asc" or "desc". Dates and
+// numbers compare by value, everything else as case insensitive text.
+// Entries missing the value come last, ties are ordered by URL
+func (e Entries) SortBy(key string, order string) Entries {
+	out := append(Entries{}, e...)
+	desc := order == "desc"
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i].Get(key), out[j].Get(key)
+		if a == nil || b == nil {
+			if a == nil && b == nil {
+				return out[i].URL < out[j].URL
+			}
+			return b == nil
+		}
+		c := compareValues(a, b)
+		if c == 0 {
+			return out[i].URL < out[j].URL
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	return out
+}
+
+// Limit keeps at most the first n entries
+func (e Entries) Limit(n int) Entries {
+	if n < 0 {
+		n = 0
+	}
+	if n > len(e) {
+		n = len(e)
+	}
+	return e[:n]
+}
+
+// Offset skips the first n entries
+func (e Entries) Offset(n int) Entries {
+	if n < 0 {
+		n = 0
+	}
+	if n > len(e) {
+		n = len(e)
+	}
+	return e[n:]
+}
+
+// GroupBy splits entries by their frontmatter value at key, keeping the
+// order groups are first seen in. Entries with list values are added to a
+// group per item, entries without the value are left out
+func (e Entries) GroupBy(key string) []EntryGroup {
+	return groupEntries(e, func(entry *Entry) []string {
+		return entry.Strings(key)
+	})
+}
+
+// GroupByDate splits entries by their date at key formatted with a Go time
+// layout, e.g. "2006" to group by year
+func (e Entries) GroupByDate(key string, layout string) []EntryGroup {
+	return groupEntries(e, func(entry *Entry) []string {
+		if !entry.HasDate(key) {
+			return nil
+		}
+		return []string{entry.FormatDate(key, layout)}
+	})
+}
+
+func groupEntries(entries Entries, keys func(*Entry) []string) []EntryGroup {
+	var groups []EntryGroup
+	index := make(map[string]int)
+	for _, entry := range entries {
+		for _, key := range keys(entry) {
+			i, ok := index[key]
+			if !ok {
+				i = len(groups)
+				index[key] = i
+				groups = append(groups, EntryGroup{Key: key, Entries: Entries{}})
+			}
+			groups[i].Entries = append(groups[i].Entries, entry)
+		}
+	}
+	return groups
+}
+
+// compareValues orders two frontmatter values, returning -1, 0 or 1
+func compareValues(a, b interface{}) int {
+	if ta, ok := parseDate(a); ok {
+		if tb, ok := parseDate(b); ok {
+			return ta.Compare(tb)
+		}
+	}
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(strings.ToLower(fmt.Sprint(a)), strings.ToLower(fmt.Sprint(b)))
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
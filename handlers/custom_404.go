@@ -1,50 +1,65 @@
 package handlers
 
 import (
-	"html/template"
 	"net/http"
+	"strings"
 
-	"github.com/gobuffalo/plush"
+	"github.com/ZacxDev/go-static-site/config"
 )
 
-func GetCustom404Handler(notFoundTemplateFile string) func(w http.ResponseWriter, r *http.Request) {
-
+// GetCustom404Handler renders the manifest's not found page into its layout
+// like any other page, in the language the requested path is prefixed with
+func GetCustom404Handler(site *Site) func(w http.ResponseWriter, r *http.Request) {
 	var fn = func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusNotFound)
-
-		ctx := plush.NewContext()
-
-		// Load the base layout
-		baseLayout, err := template.ParseFiles("templates/layouts/base.plush.html")
-		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		m := site.Manifest
+		if m.NotFoundPageSource == "" {
+			http.NotFound(w, r)
 			return
 		}
 
-		// Load the 404 template
-		notFoundTemplate, err := plush.Parse(notFoundTemplateFile)
+		rendered, err := site.Renderer.Render(notFoundPage(m, r.URL.Path))
 		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			site.writeRenderError(w, r, err)
 			return
 		}
 
-		// Execute the 404 template
-		notFoundContent, err := notFoundTemplate.Exec(ctx)
-		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
+		w.Header().Set("Content-Type", rendered.ContentType)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(rendered.Body)
+	}
 
-		// Set the 404 content in the base layout context
-		ctx.Set("yield", template.HTML(notFoundContent))
+	return fn
+}
 
-		// Execute the base layout
-		err = baseLayout.Execute(w, ctx)
-		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
+// notFoundPage is the page rendered for a path that matches no route. The
+// not found page can't declare partial_deps, so every partial is allowed
+func notFoundPage(m *config.SiteManifest, path string) PageRoute {
+	templateType := "PLUSH"
+	if strings.HasSuffix(m.NotFoundPageSource, ".md") {
+		templateType = "MARKDOWN"
+	}
+
+	lang := m.DefaultLanguage()
+	params := map[string]string{}
+	routePath := path
+	prefix, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	for _, l := range m.Languages() {
+		if l == prefix && m.IsPrefixed(l) {
+			lang = l
+			params["lang"] = l
+			routePath = "/" + rest
 		}
 	}
 
-	return fn
+	return PageRoute{
+		Route: config.Route{
+			Path:         routePath,
+			Source:       m.NotFoundPageSource,
+			TemplateType: templateType,
+			PartialDeps:  config.SortedKeys(m.Partials),
+		},
+		Lang:    lang,
+		Params:  params,
+		URLPath: path,
+	}
 }
@@ -2,114 +2,436 @@ package handlers
 
 import (
 	"fmt"
-	"html/template"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/ZacxDev/go-static-site/config"
+	"github.com/ZacxDev/go-static-site/frontmatter"
 	"github.com/ZacxDev/go-static-site/javascript"
 	"github.com/ZacxDev/go-static-site/utils"
 	"github.com/gobuffalo/plush"
-	"github.com/gomarkdown/markdown"
-	"github.com/gomarkdown/markdown/parser"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
 
-var registeredRoutes []string
+// Site is a loaded manifest along with everything derived from it that is
+// needed to route and render its pages
+type Site struct {
+	Manifest     *config.SiteManifest
+	Translations map[string]map[string]string
+	EmittedJS    map[string]string
+	Pages        []PageRoute
+	Renderer     *Renderer
+
+	// RegisteredRoutes lists every routed path, static routes are listed
+	// both with their language pattern and without it
+	RegisteredRoutes []string
+
+	// Collections holds the entries of every manifest collection in their
+	// configured order
+	Collections map[string]Entries
+
+	// Publish decides which drafts and scheduled pages were included
+	Publish PublishOptions
+
+	// ErrorOverlay shows render errors in the browser with their source,
+	// otherwise they are logged and answered with a plain 500
+	ErrorOverlay bool
+}
 
-func SetupRouter() (*mux.Router, error) {
-	router := mux.NewRouter()
+// SitemapEntries lists the canonical URL of every page with its language
+// alternates. Unprefixed aliases of default language pages and routes
+// excluded from the sitemap are left out
+func (s *Site) SitemapEntries() []utils.SitemapEntry {
+	m := s.Manifest
+
+	// Group language variants by the path they share
+	variants := make(map[string][]PageRoute)
+	var order []string
+	seen := make(map[string]bool)
+	for _, page := range s.Pages {
+		if page.Route.ExcludeFromSitemap {
+			continue
+		}
+		canonical := m.LocalizedPath(page.Lang, page.Route.Path)
+		if seen[canonical] {
+			continue
+		}
+		seen[canonical] = true
 
-	// Load manifest
-	manifest, err := loadManifest("manifest.yaml")
+		if _, ok := variants[page.Route.Path]; !ok {
+			order = append(order, page.Route.Path)
+		}
+		variants[page.Route.Path] = append(variants[page.Route.Path], page)
+	}
+
+	var entries []utils.SitemapEntry
+	for _, path := range order {
+		pages := variants[path]
+
+		var alternates []utils.SitemapAlternate
+		if m.IsMultilingual() && len(pages) > 1 {
+			for _, page := range pages {
+				alternates = append(alternates, utils.SitemapAlternate{
+					Hreflang: page.Lang,
+					Href:     m.URL(m.LocalizedPath(page.Lang, path)),
+				})
+				if page.Lang == m.DefaultLanguage() {
+					alternates = append(alternates, utils.SitemapAlternate{
+						Hreflang: "x-default",
+						Href:     m.URL(m.LocalizedPath(page.Lang, path)),
+					})
+				}
+			}
+		}
+
+		for _, page := range pages {
+			entries = append(entries, utils.SitemapEntry{
+				Loc:        m.URL(m.LocalizedPath(page.Lang, path)),
+				LastMod:    lastModified(page.Route.Source),
+				ChangeFreq: page.Route.ChangeFreq,
+				Priority:   page.Route.Priority,
+				Alternates: alternates,
+				Group:      s.sitemapGroup(page),
+			})
+		}
+	}
+
+	return entries
+}
+
+// Sitemaps renders the site's sitemap files
+func (s *Site) Sitemaps() ([]utils.SitemapFile, error) {
+	return utils.BuildSitemaps(s.SitemapEntries(), s.SitemapOptions())
+}
+
+// RobotsTxt renders robots.txt for the current SITE_ENV pointing at the
+// given sitemaps, ok is false when the manifest doesn't configure one
+func (s *Site) RobotsTxt(sitemaps []utils.SitemapFile) (string, bool) {
+	if s.Manifest.Robots == nil {
+		return "", false
+	}
+
+	sitemapURL := s.Manifest.URL("/" + utils.SitemapRoot(sitemaps))
+	return utils.GenerateRobotsTxt(s.Manifest.Robots, os.Getenv("SITE_ENV"), []string{sitemapURL}), true
+}
+
+// Layouts lists every layout the site's pages are rendered into, whether
+// set by their route, the manifest or their frontmatter, along with the
+// layouts those are nested into
+func (s *Site) Layouts() []string {
+	m := s.Manifest
+	var layouts []string
+	seen := make(map[string]bool)
+	add := func(layout string) {
+		// A broken chain still lists the layouts up to the problem
+		chain, _ := config.LayoutChain(layout)
+		for _, l := range chain {
+			if !seen[l] {
+				seen[l] = true
+				layouts = append(layouts, l)
+			}
+		}
+	}
+
+	sources := make(map[string]bool)
+	for _, page := range s.Pages {
+		add(m.RouteLayout(page.Route))
+		if !sources[page.Route.Source] {
+			sources[page.Route.Source] = true
+			add(frontmatterLayout(page.Route.Source))
+		}
+	}
+	if m.NotFoundPageSource != "" {
+		add(m.RouteLayout(config.Route{}))
+		add(frontmatterLayout(m.NotFoundPageSource))
+	}
+
+	return layouts
+}
+
+// frontmatterLayout is the layout set in the frontmatter of a page source,
+// if any
+func frontmatterLayout(source string) string {
+	content, _, err := templates.readFile(source)
 	if err != nil {
-		return nil, fmt.Errorf("error loading manifest: %v", err)
+		return ""
 	}
+	doc, err := frontmatter.Parse(content)
+	if err != nil {
+		return ""
+	}
+	return config.LayoutSource(NewPageMeta(doc.Params).String("layout"))
+}
 
-	// Set up middleware
-	router.NotFoundHandler = http.HandlerFunc(GetCustom404Handler(manifest.NotFoundPageSource))
+// sitemapGroup is the shard a page's sitemap entry belongs to
+func (s *Site) sitemapGroup(page PageRoute) string {
+	switch s.Manifest.Sitemap.SplitBy {
+	case "language":
+		return page.Lang
+	case "route":
+		group := strings.Trim(sitemapGroupPattern.ReplaceAllString(page.Pattern, "-"), "-")
+		if group == "" {
+			return "root"
+		}
+		return group
+	}
+	return ""
+}
 
-	// Set up static file serving
-	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+var sitemapGroupPattern = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// SitemapOptions returns how the manifest wants the sitemap split
+func (s *Site) SitemapOptions() utils.SitemapOptions {
+	return utils.SitemapOptions{
+		Origin:  s.Manifest.Origin,
+		MaxURLs: s.Manifest.Sitemap.MaxURLs,
+		Grouped: s.Manifest.Sitemap.SplitBy != "",
+	}
+}
+
+// lastModified returns the modification time of source, or the zero time
+// if it can't be determined
+func lastModified(source string) time.Time {
+	info, err := os.Stat(source)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// LoadSite loads the manifest, translations and javascript targets and
+// expands the manifest routes into concrete pages, publishing the content
+// allowed by opts
+func LoadSite(manifestPath string, opts PublishOptions) (*Site, error) {
+	return loadSite(manifestPath, opts, nil)
+}
+
+// ReloadSite loads the site again with the options of prev but reuses its
+// javascript bundles when the manifest's javascript targets are unchanged,
+// so edits to pages and templates don't pay for an esbuild run
+func ReloadSite(manifestPath string, prev *Site) (*Site, error) {
+	return loadSite(manifestPath, prev.Publish, prev)
+}
+
+func loadSite(manifestPath string, opts PublishOptions, prev *Site) (*Site, error) {
+	// Load manifest
+	manifest, err := config.LoadManifest(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading manifest: %v", err)
+	}
 
 	translations, err := loadTranslations(manifest.Translations)
 	if err != nil {
 		return nil, fmt.Errorf("error loading translations: %v", err)
 	}
 
-	var langPathPattern string
-	if len(manifest.Translations) > 0 {
-		var langPathPatternB strings.Builder
-		langPathPatternB.WriteString("/{lang:")
-		for i, translation := range manifest.Translations {
-			langPathPatternB.WriteString(translation.Code)
-
-			if i+1 < len(manifest.Translations) {
-				langPathPatternB.WriteRune('|')
-			}
-		}
-		langPathPatternB.WriteString("}")
-		langPathPattern = langPathPatternB.String()
+	var emittedJS map[string]string
+	if prev != nil && reflect.DeepEqual(prev.Manifest.JavascriptTargets, manifest.JavascriptTargets) {
+		emittedJS = prev.EmittedJS
 	} else {
-		langPathPattern = manifest.Translations[0].Code
+		emittedJS, err = javascript.CompileJSTarget(manifest.JavascriptTargets)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
 	}
 
-	emittedJS, err := javascript.CompileJSTarget(manifest.JavascriptTargets)
-	if err != nil {
-		return nil, errors.WithStack(err)
+	site := &Site{
+		Manifest:     manifest,
+		Translations: translations,
+		EmittedJS:    emittedJS,
+		Publish:      opts,
+	}
+
+	// Pattern matching every language served under a /{lang} prefix
+	var prefixedLangs []string
+	for _, lang := range manifest.Languages() {
+		if manifest.IsPrefixed(lang) {
+			prefixedLangs = append(prefixedLangs, lang)
+		}
 	}
+	var langPathPattern string
+	if len(prefixedLangs) > 0 {
+		langPathPattern = "/{lang:" + strings.Join(prefixedLangs, "|") + "}"
+	}
+
+	defaultLang := manifest.DefaultLanguage()
 
-	// Set up routes from manifest
+	// Expand routes from manifest
 	for _, route := range manifest.Routes {
 		re := regexp.MustCompile("\\/:\\w+")
 		isDynParam := re.Match([]byte(route.Path))
 		if isDynParam {
 			// Handle dynamic blog post routes
-			err := setupDynamicParamRoutes(router, route, emittedJS, translations, manifest)
+			pages, err := setupDynamicParamRoutes(route, manifest, opts)
 			if err != nil {
 				return nil, fmt.Errorf("error setting up blog routes: %v", err)
 			}
+			site.Pages = append(site.Pages, pages...)
+			for _, page := range pages {
+				site.RegisteredRoutes = append(site.RegisteredRoutes, page.URLPath)
+			}
 		} else {
-			// Set up route with optional language parameter
-			router.HandleFunc(langPathPattern+route.Path, DynamicHandler(route, manifest, emittedJS, translations)).Methods("GET")
-			router.HandleFunc(route.Path, DynamicHandler(route, manifest, emittedJS, translations)).Methods("GET")
+			for _, lang := range manifest.Languages() {
+				page := PageRoute{
+					Route:   route,
+					Lang:    lang,
+					URLPath: manifest.LocalizedPath(lang, route.Path),
+					Pattern: route.Path,
+				}
+				if manifest.IsPrefixed(lang) {
+					page.Params = map[string]string{"lang": lang}
+				}
+				site.Pages = append(site.Pages, page)
+			}
 
-			registeredRoutes = append(registeredRoutes, langPathPattern+route.Path, route.Path)
+			// Prefixed default language pages are also served unprefixed
+			if manifest.IsPrefixed(defaultLang) {
+				site.Pages = append(site.Pages, PageRoute{
+					Route:   route,
+					Lang:    defaultLang,
+					URLPath: route.Path,
+					Pattern: route.Path,
+				})
+			}
+
+			if langPathPattern != "" {
+				site.RegisteredRoutes = append(site.RegisteredRoutes, langPathPattern+route.Path)
+			}
+			site.RegisteredRoutes = append(site.RegisteredRoutes, route.Path)
 		}
 	}
 
-	sitemap, err := utils.GenerateSitemapContent(registeredRoutes)
-	router.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(sitemap))
-	}).Methods("GET")
+	site.Collections, err = loadCollections(manifest, site.Pages)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading collections")
+	}
+	expandPaginatedRoutes(site)
+	expandTaxonomyRoutes(site)
+
+	site.Renderer = NewRenderer(manifest, emittedJS, translations, site.RegisteredRoutes, site.Collections)
+
+	return site, nil
+}
+
+// addLocalizedPage adds a generated page at its route's path in the page's
+// language. Prefixed default language pages are also served unprefixed
+func (s *Site) addLocalizedPage(page PageRoute) {
+	m := s.Manifest
+	page.URLPath = m.LocalizedPath(page.Lang, page.Route.Path)
+
+	alias := page
+	alias.URLPath = page.Route.Path
+
+	if m.IsPrefixed(page.Lang) {
+		params := map[string]string{"lang": page.Lang}
+		for k, v := range page.Params {
+			params[k] = v
+		}
+		page.Params = params
+	}
+	s.Pages = append(s.Pages, page)
+	s.RegisteredRoutes = append(s.RegisteredRoutes, page.URLPath)
+
+	if page.Lang == m.DefaultLanguage() && m.IsPrefixed(page.Lang) {
+		s.Pages = append(s.Pages, alias)
+		s.RegisteredRoutes = append(s.RegisteredRoutes, alias.URLPath)
+	}
+}
+
+func SetupRouter() (*mux.Router, error) {
+	site, err := LoadSite("manifest.yaml", PublishOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRouter(site)
+}
+
+// NewRouter creates a router serving every page of the site
+func NewRouter(site *Site) (*mux.Router, error) {
+	router := mux.NewRouter()
+
+	// Set up middleware
+	router.NotFoundHandler = http.HandlerFunc(GetCustom404Handler(site))
+
+	// Set up static file serving
+	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+
+	for _, page := range site.Pages {
+		router.HandleFunc(page.URLPath, DynamicHandler(site, page)).Methods("GET")
+	}
+
+	sitemaps, err := site.Sitemaps()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, file := range sitemaps {
+		content := file.Content
+		router.HandleFunc("/"+file.Name, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+			w.Write(content)
+		}).Methods("GET")
+	}
+
+	feeds, err := site.Feeds()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range feeds {
+		file := file
+		router.HandleFunc(file.Path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", file.ContentType)
+			w.Write(file.Content)
+		}).Methods("GET")
+	}
+
+	if path, css, ok := site.HighlightStylesheet(); ok {
+		router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/css; charset=utf-8")
+			w.Write(css)
+		}).Methods("GET")
+	}
+
+	if robots, ok := site.RobotsTxt(sitemaps); ok {
+		router.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(robots))
+		}).Methods("GET")
+	}
 
 	return router, nil
 }
 
 func setupDynamicParamRoutes(
-	router *mux.Router,
 	route config.Route,
-	emittedJS map[string]string,
-	translations map[string]map[string]string,
 	manifest *config.SiteManifest,
-) error {
+	publish PublishOptions,
+) ([]PageRoute, error) {
+	now := time.Now()
+
 	re := regexp.MustCompile(":\\w+")
 	globRoute := re.ReplaceAllString(route.Path, "*")
 	globDirPath := "pages" + globRoute
 	blogPosts, err := filepath.Glob(globDirPath)
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 
+	paramName := strings.TrimPrefix(re.FindString(route.Path), ":")
+
+	var pages []PageRoute
 	for _, postDir := range blogPosts {
 		isDir, err := isDirectory(postDir)
 		if err != nil {
-			return errors.WithStack(err)
+			return nil, errors.WithStack(err)
 		}
 
 		if !isDir {
@@ -125,8 +447,7 @@ func setupDynamicParamRoutes(
 		dynSourceRe := regexp.MustCompile("\\[\\w+\\]")
 		isDynSource := dynSourceRe.Match([]byte(route.Source))
 
-		for supportedLang := range translations {
-			// Route with language parameter
+		for _, supportedLang := range manifest.Languages() {
 			langPath := re.ReplaceAllString(route.Path, slug)
 			var source string
 			if isDynSource {
@@ -139,33 +460,43 @@ func setupDynamicParamRoutes(
 				source = route.Source
 			}
 
-			router.HandleFunc("/"+supportedLang+langPath, DynamicHandler(config.Route{
-				Path:           langPath,
-				Source:         source,
-				TemplateType:   route.TemplateType,
-				JavascriptDeps: route.JavascriptDeps,
-				PartialDeps:    route.PartialDeps,
-			}, manifest, emittedJS, translations)).Methods("GET")
-			registeredRoutes = append(registeredRoutes, "/"+supportedLang+langPath)
-		}
-	}
-
-	return nil
-}
+			params := map[string]string{paramName: slug}
+			if manifest.IsPrefixed(supportedLang) {
+				params["lang"] = supportedLang
+			}
 
-func loadManifest(filename string) (*config.SiteManifest, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, err
-	}
+			// Leave out drafts, scheduled and expired pages
+			content, _, err := templates.readFile(source)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			doc, err := parseFrontmatter(source, content)
+			if err != nil {
+				return nil, err
+			}
+			published, err := publish.isPublished(NewPageMeta(doc.Params), now)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", source, err)
+			}
+			if !published {
+				continue
+			}
 
-	var manifest config.SiteManifest
-	err = yaml.Unmarshal(data, &manifest)
-	if err != nil {
-		return nil, err
+			langRoute := route
+			langRoute.Path = langPath
+			langRoute.Source = source
+
+			pages = append(pages, PageRoute{
+				Route:   langRoute,
+				Lang:    supportedLang,
+				URLPath: manifest.LocalizedPath(supportedLang, langPath),
+				Params:  params,
+				Pattern: route.Path,
+			})
+		}
 	}
 
-	return &manifest, nil
+	return pages, nil
 }
 
 func loadTranslations(trans []config.Translation) (map[string]map[string]string, error) {
@@ -199,6 +530,27 @@ type PartialProcessingContext struct {
 	ProcessedPartials map[string]bool
 	CurrentDepth      int
 	MaxDepth          int
+
+	// Chain is the stack of partials currently being processed, outermost first
+	Chain []string
+	// Includes records every partial spliced in, in the order they were loaded
+	Includes []PartialInclude
+
+	// shortcodes renders shortcodes of markdown partials, nil outside of a
+	// page render
+	shortcodes *shortcodeRenderer
+}
+
+// PartialInclude is a partial that was spliced into a template along with
+// the chain of partials that led to it
+type PartialInclude struct {
+	Name    string
+	Source  string
+	Content string
+	Chain   []string
+
+	// hash is the hash of the partial's source file when it was loaded
+	hash string
 }
 
 // NewPartialProcessingContext creates a new context for partial processing
@@ -225,11 +577,8 @@ func PreprocessTemplate(
 		return "", fmt.Errorf("maximum partial nesting depth (%d) exceeded", ctx.MaxDepth)
 	}
 
-	// Regular expression to find partial tags: <%= partial("name") %>
-	partialRegex := regexp.MustCompile(`<%=\s*partial\("([^"]+)"\)\s*%>`)
-
 	// Find all partial references
-	matches := partialRegex.FindAllStringSubmatch(content, -1)
+	matches := config.PartialCallPattern.FindAllStringSubmatch(content, -1)
 
 	// Replace each partial reference with its content
 	for _, match := range matches {
@@ -241,26 +590,13 @@ func PreprocessTemplate(
 			return "", fmt.Errorf("circular dependency detected in partial: %s", partialName)
 		}
 
-		// Verify partial is in dependencies
-		found := false
-		for _, dep := range route.PartialDeps {
-			if dep == partialName {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return "", fmt.Errorf("partial %s not declared in partial_deps", partialName)
-		}
-
-		// Get partial configuration
-		partialConfig, exists := manifest.Partials[partialName]
-		if !exists {
-			return "", fmt.Errorf("partial %s not found in manifest", partialName)
+		partialConfig, err := lookupPartial(partialName, route, manifest)
+		if err != nil {
+			return "", err
 		}
 
 		// Load partial content
-		partialContent, err := loadPartial(partialConfig)
+		partialContent, hash, err := loadPartial(manifest, partialConfig, ctx.shortcodes)
 		if err != nil {
 			return "", errors.WithStack(err)
 		}
@@ -268,6 +604,14 @@ func PreprocessTemplate(
 		// Mark this partial as being processed
 		ctx.ProcessedPartials[partialName] = true
 		ctx.CurrentDepth++
+		ctx.Chain = append(ctx.Chain, partialName)
+		ctx.Includes = append(ctx.Includes, PartialInclude{
+			Name:    partialName,
+			Source:  partialConfig.Source,
+			Content: partialContent,
+			Chain:   append([]string(nil), ctx.Chain...),
+			hash:    hash,
+		})
 
 		// Recursively process any nested partials
 		processedContent, err := PreprocessTemplate(partialContent, route, manifest, ctx)
@@ -278,6 +622,7 @@ func PreprocessTemplate(
 		// Unmark the partial after processing
 		delete(ctx.ProcessedPartials, partialName)
 		ctx.CurrentDepth--
+		ctx.Chain = ctx.Chain[:len(ctx.Chain)-1]
 
 		// Replace the partial tag with its processed content
 		content = strings.Replace(content, fullMatch, processedContent, 1)
@@ -286,6 +631,27 @@ func PreprocessTemplate(
 	return content, nil
 }
 
+// lookupPartial returns the partial called name, which route has to declare
+// in its partial_deps
+func lookupPartial(name string, route config.Route, manifest *config.SiteManifest) (config.Partial, error) {
+	found := false
+	for _, dep := range route.PartialDeps {
+		if dep == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return config.Partial{}, fmt.Errorf("partial %s not declared in partial_deps", name)
+	}
+
+	partial, exists := manifest.Partials[name]
+	if !exists {
+		return config.Partial{}, fmt.Errorf("partial %s not found in manifest", name)
+	}
+	return partial, nil
+}
+
 func PreprocessAllTemplates(route config.Route, manifest *config.SiteManifest) func(string) (string, error) {
 	ctx := NewPartialProcessingContext()
 	return func(content string) (string, error) {
@@ -293,222 +659,201 @@ func PreprocessAllTemplates(route config.Route, manifest *config.SiteManifest) f
 	}
 }
 
-func DynamicHandler(
+// preprocessSource preprocesses content read from source and records every
+// partial source it pulled in. Shortcodes of markdown partials are rendered
+// with pageCtx. Failures are reported as a RenderError
+// carrying the partial chain that led to them. Results are cached unless
+// shortcodes were rendered, their output depends on the page
+func preprocessSource(
+	source string,
+	content string,
 	route config.Route,
 	manifest *config.SiteManifest,
-	emittedJS map[string]string,
-	translations map[string]map[string]string,
-) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := plush.NewContext()
-		vars := mux.Vars(r)
-		ctx.Set("params", vars)
-		ctx.Set("registeredRoutes", registeredRoutes)
-
-		// Get language from URL parameter, default to "en"
-		lang := vars["lang"]
-		if lang == "" {
-			lang = "en"
-		}
-
-		// Add translation helper
-		ctx.Set("text", func(key string) string {
-			if t, ok := translations[lang][key]; ok {
-				return t
-			}
-			return key
-		})
-
-		ctx.Set("lang", lang)
-
-		var supportedLangs []string
-		for lang := range translations {
-			supportedLangs = append(supportedLangs, lang)
+	pageCtx *plush.Context,
+	deps *dependencySet,
+) (string, *PartialProcessingContext, error) {
+	ctx := NewPartialProcessingContext()
+	if processed, includes, ok := templates.preprocess(source, content, route, manifest); ok {
+		ctx.Includes = includes
+		for _, include := range includes {
+			deps.add(include.Source)
 		}
+		return processed, ctx, nil
+	}
 
-		ctx.Set("supportedLangs", supportedLangs)
-		ctx.Set("appOrigin", os.Getenv("APP_ORIGIN"))
-
-		// Pass in javascript bundle paths
-		for _, tsDepLabl := range route.JavascriptDeps {
-			for label, publicPath := range emittedJS {
-				if label == tsDepLabl {
-					ctx.Set(tsDepLabl, publicPath)
-				}
-			}
+	ctx.shortcodes = newShortcodeRenderer(manifest, pageCtx, deps)
+	processed, err := PreprocessTemplate(content, route, manifest, ctx)
+	for _, include := range ctx.Includes {
+		deps.add(include.Source)
+	}
+	if err != nil {
+		return "", nil, &RenderError{
+			File:         source,
+			Message:      err.Error(),
+			PartialChain: ctx.Chain,
+			Err:          err,
 		}
+	}
 
-		// Add helper functions
-		ctx.Set("startsWith", func(s string, prefix string) bool {
-			return strings.HasPrefix(s, prefix)
-		})
-
-		ctx.Set("matches", func(s string, pat string) bool {
-			re := regexp.MustCompile(pat)
-			return re.Match([]byte(s))
-		})
-
-		ctx.Set("replace", func(s string, old string, n string) string {
-			return strings.Replace(s, old, n, 1)
-		})
-
-		ctx.Set("replaceAll", func(s string, old string, n string) string {
-			return strings.ReplaceAll(s, old, n)
-		})
-
-		ctx.Set("replacePattern", func(s string, pat, n string) string {
-			re := regexp.MustCompile(pat)
-			return re.ReplaceAllString(s, n)
-		})
+	if !ctx.shortcodes.rendered {
+		templates.storePreprocessed(source, content, manifest, ctx.Includes, processed)
+	}
+	return processed, ctx, nil
+}
 
-		// Add canonical URL helper
-		pathNoLang := strings.Replace(r.URL.Path, "/"+lang+"/", "/", 1)
-		c := fmt.Sprintf("%s/%s%s", manifest.Origin, lang, pathNoLang)
-		ctx.Set("canonical", c)
-
-		ctx.Set("currentPath", r.URL.Path)
-
-		var content string
-		var err error
-
-		switch route.TemplateType {
-		case "PLUSH":
-			content, err = renderPlushTemplate(route.Source, route, manifest, ctx)
-		case "MARKDOWN":
-			var title, desc string
-			content, title, desc, err = renderMarkdownTemplate(route.Source, route, manifest)
-			ctx.Set("title", title)
-			ctx.Set("description", desc)
-		default:
-			http.Error(w, "Unsupported template type", http.StatusInternalServerError)
-			return
-		}
+// execTemplate parses and executes preprocessed plush content, mapping
+// failures back to the file or partial they came from
+func execTemplate(
+	source string,
+	content string,
+	preprocessed string,
+	partials *PartialProcessingContext,
+	ctx *plush.Context,
+) (string, error) {
+	template, err := templates.parse(source, preprocessed)
+	if err != nil {
+		return "", newTemplateError(source, content, preprocessed, partials, err)
+	}
 
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Error rendering template: %v", err), http.StatusInternalServerError)
-			return
-		}
+	out, err := template.Exec(ctx)
+	if err != nil {
+		return "", newTemplateError(source, content, preprocessed, partials, err)
+	}
 
-		ctx.Set("yield", template.HTML(content))
+	return out, nil
+}
 
-		baseContentB, err := os.ReadFile("templates/layouts/base.plush.html")
+func DynamicHandler(site *Site, page PageRoute) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rendered, err := site.Renderer.Render(page)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error parsing base layout: %v", err), http.StatusInternalServerError)
+			site.writeRenderError(w, r, err)
 			return
 		}
 
-		// Preprocess base template for partials
-		preprocess := PreprocessAllTemplates(route, manifest)
-		baseContent, err := preprocess(string(baseContentB))
+		w.Header().Set("Content-Type", rendered.ContentType)
+		w.WriteHeader(rendered.Status)
+		_, err = w.Write(rendered.Body)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error preprocessing base layout: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Error writing response: %v", err), http.StatusInternalServerError)
 			return
 		}
+	}
+}
 
-		baseLayout, err := plush.Parse(baseContent)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Error parsing base layout: %v", err), http.StatusInternalServerError)
-			return
-		}
+// writeRenderError responds to a request whose page failed to render
+func (s *Site) writeRenderError(w http.ResponseWriter, r *http.Request, err error) {
+	if s.ErrorOverlay {
+		WriteErrorOverlay(w, err)
+		return
+	}
 
-		pageHtml, err := baseLayout.Exec(ctx)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Error executing base layout: %v", err), http.StatusInternalServerError)
-			return
-		}
+	log.Printf("Error rendering %s: %v", r.URL.Path, err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
 
-		_, err = w.Write([]byte(pageHtml))
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Error writing response: %v", err), http.StatusInternalServerError)
-			return
-		}
+func renderPlushTemplate(source string, route config.Route, manifest *config.SiteManifest, ctx *plush.Context, deps *dependencySet) (string, *PageMeta, error) {
+	content, _, err := templates.readFile(source)
+	if err != nil {
+		return "", nil, err
 	}
-}
 
-func renderPlushTemplate(source string, route config.Route, manifest *config.SiteManifest, ctx *plush.Context) (string, error) {
-	content, err := os.ReadFile(source)
+	// Frontmatter is stripped before parsing and exposed to the page itself
+	// as well as the layout
+	doc, err := parseFrontmatter(source, content)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
+	meta := NewPageMeta(doc.Params)
+	setPageMeta(ctx, meta)
 
 	// Preprocess template for partials
-	preprocess := PreprocessAllTemplates(route, manifest)
-	preprocessed, err := preprocess(string(content))
+	preprocessed, partials, err := preprocessSource(source, doc.Body, route, manifest, ctx, deps)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	template, err := plush.Parse(preprocessed)
+	out, err := execTemplate(source, doc.Body, preprocessed, partials, ctx)
 	if err != nil {
-		return "", err
+		return "", nil, offsetRenderError(err, source, doc.BodyLine-1)
 	}
 
-	return template.Exec(ctx)
+	return out, meta, nil
 }
 
-func renderMarkdownTemplate(source string, route config.Route, manifest *config.SiteManifest) (string, string, string, error) {
-	content, err := os.ReadFile(source)
+func renderMarkdownTemplate(source string, route config.Route, manifest *config.SiteManifest, ctx *plush.Context, deps *dependencySet) (string, *PageMeta, error) {
+	content, _, err := templates.readFile(source)
 	if err != nil {
-		return "", "", "", err
+		return "", nil, err
 	}
 
-	// Split the content into frontmatter and Markdown
-	parts := strings.SplitN(string(content), "\n---\n", 3)
-	if len(parts) != 2 {
-		return "", "", "", fmt.Errorf("invalid Markdown file format: %s", source)
+	doc, err := parseFrontmatter(source, content)
+	if err != nil {
+		return "", nil, err
 	}
+	meta := NewPageMeta(doc.Params)
+	setPageMeta(ctx, meta)
 
-	// Parse the frontmatter
-	var metadata map[string]string
-	err = yaml.Unmarshal([]byte(parts[0]), &metadata)
+	// Preprocess markdown content for partials
+	preprocessed, _, err := preprocessSource(source, doc.Body, route, manifest, ctx, deps)
 	if err != nil {
-		return "", "", "", fmt.Errorf("error parsing frontmatter: %v", err)
+		return "", nil, err
 	}
 
-	// Preprocess markdown content for partials
-	preprocess := PreprocessAllTemplates(route, manifest)
-	preprocessed, err := preprocess(parts[1])
+	htmlContent, toc, err := renderMarkdown(manifest, []byte(preprocessed), newShortcodeRenderer(manifest, ctx, deps))
+	if err != nil {
+		return "", nil, offsetRenderError(withSource(err, source), source, doc.BodyLine-1)
+	}
+	ctx.Set("toc", toc)
+	contentHtml, err := wrapMarkdown(string(htmlContent), route, manifest, ctx, deps)
 	if err != nil {
-		return "", "", "", err
+		return "", nil, err
 	}
 
-	// Parse the Markdown content
-	extensions := parser.CommonExtensions | parser.AutoHeadingIDs
-	p := parser.NewWithExtensions(extensions)
-	md := []byte(preprocessed)
-	htmlContent := markdown.ToHTML(md, p, nil)
-	contentHtml := strings.Replace(`
-  <article class="flex flex-col gap-4 blog-container">
-  [content]
-  </article>
-  `, "[content]", string(htmlContent), 1)
+	return contentHtml, meta, nil
+}
 
-	return contentHtml, metadata["title"], metadata["description"], nil
+// parseFrontmatter splits a page source into its frontmatter and body,
+// reporting malformed frontmatter against the source file
+func parseFrontmatter(source string, content []byte) (*frontmatter.Document, error) {
+	doc, err := frontmatter.Parse(content)
+	if err != nil {
+		if fe, ok := err.(*frontmatter.Error); ok {
+			return nil, &RenderError{
+				File:    source,
+				Line:    fe.Line,
+				Message: fmt.Sprintf("invalid %s frontmatter: %s", fe.Format, fe.Message),
+				Excerpt: excerptFromFile(source, fe.Line),
+				Err:     err,
+			}
+		}
+		return nil, err
+	}
+	return doc, nil
 }
 
-func loadPartial(partial config.Partial) (string, error) {
-	content, err := os.ReadFile(partial.Source)
+// loadPartial returns the template content of a partial along with the hash
+// of its source file
+func loadPartial(manifest *config.SiteManifest, partial config.Partial, shortcodes *shortcodeRenderer) (string, string, error) {
+	content, hash, err := templates.readFile(partial.Source)
 	if err != nil {
-		return "", errors.WithStack(err)
+		return "", "", errors.WithStack(err)
 	}
 
 	switch partial.TemplateType {
 	case "PLUSH":
-		return string(content), nil
+		return string(content), hash, nil
 	case "MARKDOWN":
-		extensions := parser.CommonExtensions | parser.AutoHeadingIDs
-		p := parser.NewWithExtensions(extensions)
-		htmlContent := markdown.ToHTML(content, p, nil)
-		return string(htmlContent), nil
+		htmlContent, _, err := renderMarkdown(manifest, content, shortcodes)
+		if err != nil {
+			return "", "", withSource(err, partial.Source)
+		}
+		return string(htmlContent), hash, nil
 	default:
-		return "", fmt.Errorf("unsupported partial template type: %s", partial.TemplateType)
+		return "", "", fmt.Errorf("unsupported partial template type: %s", partial.TemplateType)
 	}
 }
 
-func GetRegisteredRoutes() []string {
-	return registeredRoutes
-}
-
 func isDirectory(path string) (bool, error) {
 	info, err := os.Stat(path)
 	if err != nil {
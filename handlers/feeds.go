@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"github.com/ZacxDev/go-static-site/config"
+	"github.com/ZacxDev/go-static-site/utils"
+	"github.com/pkg/errors"
+)
+
+// FeedFile is a generated feed, Path is the URL path it is served at
+type FeedFile struct {
+	Path        string
+	ContentType string
+	Content     []byte
+}
+
+// Feeds renders every feed in the manifest, in every language and format
+func (s *Site) Feeds() ([]FeedFile, error) {
+	m := s.Manifest
+
+	pagesByURL := make(map[string]PageRoute, len(s.Pages))
+	for _, page := range s.Pages {
+		pagesByURL[page.URLPath] = page
+	}
+
+	var files []FeedFile
+	for _, name := range config.SortedKeys(m.Feeds) {
+		fc := m.Feeds[name]
+		entries, err := collectEntries(m, s.Pages, fc.Route, name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, lang := range m.Languages() {
+			feed := utils.Feed{
+				Title:       translate(s.Translations, lang, fc.Title),
+				Description: translate(s.Translations, lang, fc.Description),
+				Link:        m.URL(m.LocalizedPath(lang, fc.BasePath())),
+				Language:    lang,
+			}
+
+			for _, entry := range entries.Lang(lang).SortBy("date", "desc").Limit(fc.ItemLimit()) {
+				item := utils.FeedItem{
+					ID:        entry.Permalink,
+					Title:     entry.Title,
+					URL:       entry.Permalink,
+					Summary:   entry.String(fc.SummaryField()),
+					Author:    entry.String("author"),
+					Published: entry.Date("date"),
+					Updated:   entry.Date("updated"),
+					Tags:      entry.Strings("tags"),
+				}
+				if fc.FullContent {
+					content, err := s.Renderer.RenderContent(pagesByURL[entry.URL])
+					if err != nil {
+						return nil, errors.Wrapf(err, "error rendering %s for feed %s", entry.Source, name)
+					}
+					item.ContentHTML = absoluteURLs(m, content)
+				}
+				feed.Items = append(feed.Items, item)
+			}
+
+			for _, format := range fc.FormatList() {
+				path := feedPath(m, fc, lang, format)
+				feed.FeedURL = m.URL(path)
+				content, err := utils.GenerateFeed(format, feed)
+				if err != nil {
+					return nil, errors.Wrapf(err, "error generating %s feed %s", format, name)
+				}
+				files = append(files, FeedFile{
+					Path:        path,
+					ContentType: utils.FeedContentType(format),
+					Content:     content,
+				})
+			}
+		}
+	}
+
+	return files, nil
+}
+
+var rootRelativeURLPattern = regexp.MustCompile(`(href|src)="/([^/"][^"]*)?"`)
+
+// absoluteURLs prefixes root relative links and images with the site origin
+// so feed content works outside the site
+func absoluteURLs(manifest *config.SiteManifest, content string) string {
+	return rootRelativeURLPattern.ReplaceAllStringFunc(content, func(match string) string {
+		attr, path, _ := strings.Cut(match, "=")
+		return attr + `="` + manifest.URL(strings.Trim(path, `"`)) + `"`
+	})
+}
+
+// feedLinks renders the autodiscovery links of every feed in lang
+func feedLinks(manifest *config.SiteManifest, translations map[string]map[string]string, lang string) template.HTML {
+	var b strings.Builder
+	for _, name := range config.SortedKeys(manifest.Feeds) {
+		fc := manifest.Feeds[name]
+		title := html.EscapeString(translate(translations, lang, fc.Title))
+		for _, format := range fc.FormatList() {
+			contentType, _, _ := strings.Cut(utils.FeedContentType(format), ";")
+			href := html.EscapeString(manifest.URL(feedPath(manifest, fc, lang, format)))
+			fmt.Fprintf(&b, `<link rel="alternate" type="%s" title="%s" href="%s">`+"\n", contentType, title, href)
+		}
+	}
+	return template.HTML(b.String())
+}
+
+func feedPath(manifest *config.SiteManifest, fc config.Feed, lang string, format string) string {
+	return manifest.LocalizedPath(lang, strings.TrimSuffix(fc.BasePath(), "/")+"/"+config.FeedFormats[format])
+}
+
+// translate looks key up in lang's translations, returning it as is when
+// there is no translation
+func translate(translations map[string]map[string]string, lang string, key string) string {
+	if t, ok := translations[lang][key]; ok {
+		return t
+	}
+	return key
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ZacxDev/go-static-site/config"
+	"github.com/ZacxDev/go-static-site/utils"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+	"github.com/sourcegraph/syntaxhighlight"
+)
+
+// HighlightStylesheet returns the generated theme of class based syntax
+// highlighting and the path it is served at
+func (s *Site) HighlightStylesheet() (string, []byte, bool) {
+	hl := s.Manifest.Markdown.Highlight
+	if hl == nil || hl.Inline() {
+		return "", nil, false
+	}
+	return hl.CSSPath(), utils.HighlightCSS(hl.ThemeOrDefault()), true
+}
+
+// highlightStylesheetLink links the generated theme from a layout's <head>,
+// it renders nothing when styles are inline or highlighting is off
+func highlightStylesheetLink(manifest *config.SiteManifest) template.HTML {
+	hl := manifest.Markdown.Highlight
+	if hl == nil || hl.Inline() {
+		return ""
+	}
+	return template.HTML(fmt.Sprintf(`<link rel="stylesheet" href="%s">`, template.HTMLEscapeString(hl.CSSPath())))
+}
+
+// highlightHook renders fenced and indented code blocks highlighted
+func highlightHook(hl *config.Highlight) html.RenderNodeFunc {
+	return func(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+		block, ok := node.(*ast.CodeBlock)
+		if !ok || !entering {
+			return ast.GoToNext, false
+		}
+		lang, marked := parseCodeInfo(string(block.Info))
+		io.WriteString(w, highlightCode(hl, block.Literal, lang, marked))
+		return ast.GoToNext, true
+	}
+}
+
+// fenceRangesPattern matches opening fences with highlighted lines such as
+// ```go {3,5-7}
+var fenceRangesPattern = regexp.MustCompile("(?m)^( {0,3}(?:`{3,}|~{3,})) *([^\\s{`~]+) +\\{([^}\n]*)\\} *$")
+
+// normalizeFences rewrites ```go {3,5-7} as ```go{3,5-7}, the parser only
+// accepts info strings without spaces
+func normalizeFences(md []byte) []byte {
+	return fenceRangesPattern.ReplaceAllFunc(md, func(line []byte) []byte {
+		m := fenceRangesPattern.FindSubmatch(line)
+		ranges := strings.Join(strings.Fields(string(m[3])), "")
+		return []byte(string(m[1]) + string(m[2]) + "{" + ranges + "}")
+	})
+}
+
+// lineRange is an inclusive range of line numbers
+type lineRange struct {
+	first, last int
+}
+
+// markedLines are the lines of a code block to highlight. They are kept as
+// ranges so a range such as {1-1000000000} costs no more than {1-2}
+type markedLines []lineRange
+
+func (m markedLines) has(n int) bool {
+	for _, r := range m {
+		if n >= r.first && n <= r.last {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCodeInfo splits a code block's info string such as `go {3,5-7}` into
+// its language and the lines to highlight. Malformed and reversed ranges
+// are ignored
+func parseCodeInfo(info string) (string, markedLines) {
+	var marked markedLines
+	info = strings.TrimSpace(info)
+
+	if start := strings.Index(info, "{"); start >= 0 {
+		ranges := strings.TrimSuffix(info[start+1:], "}")
+		if end := strings.Index(ranges, "}"); end >= 0 {
+			ranges = ranges[:end]
+		}
+		info = info[:start]
+
+		for _, part := range strings.Split(ranges, ",") {
+			from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+			first, err := strconv.Atoi(strings.TrimSpace(from))
+			if err != nil {
+				continue
+			}
+			last := first
+			if isRange {
+				last, err = strconv.Atoi(strings.TrimSpace(to))
+				if err != nil {
+					continue
+				}
+			}
+			if first < 1 || first > last {
+				continue
+			}
+			marked = append(marked, lineRange{first, last})
+		}
+	}
+
+	lang := ""
+	if fields := strings.Fields(info); len(fields) > 0 {
+		lang = fields[0]
+	}
+	return lang, marked
+}
+
+// highlightCode renders code as a <pre> with a span per line, colored with
+// theme classes or inline styles
+func highlightCode(hl *config.Highlight, code []byte, lang string, marked markedLines) string {
+	theme := hl.ThemeOrDefault()
+	code = []byte(strings.TrimSuffix(string(code), "\n"))
+
+	printer := &linePrinter{lines: []*strings.Builder{{}}}
+	if !isPlainLanguage(lang) {
+		printer.attr = func(kind syntaxhighlight.Kind) string {
+			class := syntaxhighlight.DefaultHTMLConfig.Class(kind)
+			if class == "" || class == "pln" {
+				return ""
+			}
+			if hl.Inline() {
+				if style, ok := theme.Tokens[class]; ok {
+					return fmt.Sprintf(`style="%s"`, style)
+				}
+				return ""
+			}
+			return fmt.Sprintf(`class="%s"`, class)
+		}
+	}
+	// The generic lexer can't fail, tokens it doesn't know are punctuation
+	syntaxhighlight.Print(syntaxhighlight.NewScanner(code), io.Discard, printer)
+
+	var b strings.Builder
+	if hl.Inline() {
+		fmt.Fprintf(&b, `<pre class="highlight" style="background-color:%s;color:%s;padding:1em;overflow-x:auto">`, theme.Background, theme.Foreground)
+	} else {
+		b.WriteString(`<pre class="highlight">`)
+	}
+	if lang != "" {
+		fmt.Fprintf(&b, `<code class="language-%s">`, template.HTMLEscapeString(lang))
+	} else {
+		b.WriteString("<code>")
+	}
+
+	width := len(strconv.Itoa(len(printer.lines)))
+	for i, line := range printer.lines {
+		n := i + 1
+		switch {
+		case hl.Inline() && marked.has(n):
+			fmt.Fprintf(&b, `<span style="display:flex;background-color:%s">`, theme.HighlightedLine)
+		case hl.Inline():
+			b.WriteString(`<span style="display:flex">`)
+		case marked.has(n):
+			b.WriteString(`<span class="line hl">`)
+		default:
+			b.WriteString(`<span class="line">`)
+		}
+
+		if hl.LineNumbers {
+			if hl.Inline() {
+				fmt.Fprintf(&b, `<span style="min-width:%dch;padding-right:1em;text-align:right;user-select:none;color:%s">%d</span>`, width, theme.LineNumber, n)
+			} else {
+				fmt.Fprintf(&b, `<span class="ln">%d</span>`, n)
+			}
+		}
+
+		b.WriteString(line.String())
+		b.WriteString("\n</span>")
+	}
+
+	b.WriteString("</code></pre>\n")
+	return b.String()
+}
+
+// linePrinter collects the highlighted tokens of each line, tokens such as
+// block comments spanning several lines are split so every line is closed
+type linePrinter struct {
+	attr  func(kind syntaxhighlight.Kind) string
+	lines []*strings.Builder
+}
+
+func (p *linePrinter) Print(_ io.Writer, kind syntaxhighlight.Kind, text string) error {
+	attr := ""
+	if p.attr != nil {
+		attr = p.attr(kind)
+	}
+
+	for i, part := range strings.Split(text, "\n") {
+		if i > 0 {
+			p.lines = append(p.lines, &strings.Builder{})
+		}
+		if part == "" {
+			continue
+		}
+		line := p.lines[len(p.lines)-1]
+		if attr == "" {
+			line.WriteString(template.HTMLEscapeString(part))
+		} else {
+			fmt.Fprintf(line, "<span %s>%s</span>", attr, template.HTMLEscapeString(part))
+		}
+	}
+	return nil
+}
+
+// isPlainLanguage reports whether code in lang is shown without token
+// colors, line numbers and highlighted lines still apply
+func isPlainLanguage(lang string) bool {
+	switch strings.ToLower(lang) {
+	case "", "text", "txt", "plain", "plaintext":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+
+	"github.com/ZacxDev/go-static-site/config"
+	"github.com/gobuffalo/plush"
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+	"github.com/pkg/errors"
+)
+
+// defaultMarkdownWrapper wraps markdown pages when no wrapper is configured
+const defaultMarkdownWrapper = `
+  <article class="flex flex-col gap-4 blog-container">
+  [content]
+  </article>
+  `
+
+// renderMarkdown converts markdown to HTML with the extensions and renderer
+// flags of the manifest's markdown section, along with its table of
+// contents, which replaces any [[toc]] marker. Shortcodes are rendered with
+// shortcodes, a fresh context is used when it is nil
+func renderMarkdown(manifest *config.SiteManifest, md []byte, shortcodes *shortcodeRenderer) ([]byte, *TableOfContents, error) {
+	return renderMarkdownAt(manifest, md, shortcodes, 1)
+}
+
+// renderMarkdownAt renders markdown starting at firstLine of its source
+func renderMarkdownAt(manifest *config.SiteManifest, md []byte, shortcodes *shortcodeRenderer, firstLine int) ([]byte, *TableOfContents, error) {
+	if shortcodes == nil {
+		shortcodes = newShortcodeRenderer(manifest, plush.NewContext(), newDependencySet())
+	}
+	expanded, rendered, err := shortcodes.expand(string(md), firstLine)
+	if err != nil {
+		return nil, nil, err
+	}
+	md = []byte(expanded)
+
+	p := parser.NewWithExtensions(manifest.Markdown.ParserExtensions())
+	opts := html.RendererOptions{
+		Flags: manifest.Markdown.RendererFlags(),
+	}
+	if manifest.Markdown.Highlight != nil {
+		opts.RenderNodeHook = highlightHook(manifest.Markdown.Highlight)
+		md = normalizeFences(md)
+	}
+	doc := markdown.Parse(md, p)
+	toc := buildTOC(doc, opts, manifest.Markdown.TOC)
+
+	out := markdown.Render(doc, html.NewRenderer(opts))
+	out = bytes.ReplaceAll(out, []byte(tocMarker), []byte(toc.HTML()))
+	out = restoreShortcodes(out, rendered)
+	return out, toc, nil
+}
+
+// wrapMarkdown renders a markdown page's HTML into the route's wrapper
+// template, which sees it as yield along with the page's context
+func wrapMarkdown(content string, route config.Route, manifest *config.SiteManifest, ctx *plush.Context, deps *dependencySet) (string, error) {
+	wrapper := manifest.MarkdownWrapper(route)
+	switch wrapper {
+	case "":
+		return strings.Replace(defaultMarkdownWrapper, "[content]", content, 1), nil
+	case config.NoMarkdownWrapper:
+		return content, nil
+	}
+
+	deps.add(wrapper)
+	source, _, err := templates.readFile(wrapper)
+	if err != nil {
+		return "", errors.Wrapf(err, "error reading markdown wrapper %s", wrapper)
+	}
+
+	preprocessed, partials, err := preprocessSource(wrapper, string(source), route, manifest, ctx, deps)
+	if err != nil {
+		return "", err
+	}
+
+	ctx.Set("yield", template.HTML(content))
+	return execTemplate(wrapper, string(source), preprocessed, partials, ctx)
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/plush"
+)
+
+// dateLayouts are the formats accepted for frontmatter dates
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// PageMeta is a page's frontmatter, exposed to templates as `page`.
+// Values keep their YAML types, nested mappings are map[string]interface{}
+// and lists are []interface{}
+type PageMeta struct {
+	Title       string
+	Description string
+	Params      map[string]interface{}
+}
+
+func NewPageMeta(params map[string]interface{}) *PageMeta {
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+
+	meta := &PageMeta{Params: params}
+	meta.Title = meta.String("title")
+	meta.Description = meta.String("description")
+	return meta
+}
+
+// setPageMeta exposes frontmatter to the page, its layouts and partials
+// as page, along with the title and description shortcuts
+func setPageMeta(ctx *plush.Context, meta *PageMeta) {
+	ctx.Set("page", meta)
+	ctx.Set("title", meta.Title)
+	ctx.Set("description", meta.Description)
+}
+
+// Get returns the value at key, nested values can be reached with dotted
+// keys such as "hero.image". It returns nil when the key is missing
+func (p *PageMeta) Get(key string) interface{} {
+	var current interface{} = p.Params
+	for _, part := range strings.Split(key, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil
+		}
+	}
+	return current
+}
+
+// Has reports whether key is set
+func (p *PageMeta) Has(key string) bool {
+	return p.Get(key) != nil
+}
+
+// String returns the value at key formatted as a string, or "" when missing
+func (p *PageMeta) String(key string) string {
+	v := p.Get(key)
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Strings returns the list at key as strings, a single value is returned as
+// a one element list
+func (p *PageMeta) Strings(key string) []string {
+	switch v := p.Get(key).(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			out = append(out, fmt.Sprint(item))
+		}
+		return out
+	case []string:
+		return v
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// Date parses the value at key as a date, returning the zero time when it is
+// missing or not a recognised date
+func (p *PageMeta) Date(key string) time.Time {
+	t, _ := parseDate(p.Get(key))
+	return t
+}
+
+// HasDate reports whether key holds a recognised date
+func (p *PageMeta) HasDate(key string) bool {
+	_, ok := parseDate(p.Get(key))
+	return ok
+}
+
+// FormatDate formats the date at key using a Go time layout, or returns ""
+// when it isn't a date
+func (p *PageMeta) FormatDate(key string, layout string) string {
+	t, ok := parseDate(p.Get(key))
+	if !ok {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+func parseDate(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ZacxDev/go-static-site/config"
+)
+
+// defaultPerPage is the page size of paginated routes that don't set one
+const defaultPerPage = 10
+
+// Pager is the page of a paginated route being rendered, exposed to
+// templates as `pager`. URLs are site relative and empty when there is no
+// such page
+type Pager struct {
+	Items      Entries
+	Current    int
+	Total      int
+	TotalItems int
+	PerPage    int
+	PrevURL    string
+	NextURL    string
+	FirstURL   string
+	LastURL    string
+	Pages      []PagerLink
+}
+
+// PagerLink links to one of the numbered pages of a paginated route
+type PagerLink struct {
+	Number    int
+	URL       string
+	IsCurrent bool
+}
+
+// HasPrev reports whether there is a previous page
+func (p *Pager) HasPrev() bool {
+	return p.PrevURL != ""
+}
+
+// HasNext reports whether there is a next page
+func (p *Pager) HasNext() bool {
+	return p.NextURL != ""
+}
+
+// newPager slices entries for page number of a route paginated at pattern
+func newPager(manifest *config.SiteManifest, lang string, pattern string, paginate *config.Paginate, entries Entries, number int) *Pager {
+	perPage := perPage(paginate)
+	total := pageCount(len(entries), perPage)
+	if number < 1 {
+		number = 1
+	}
+
+	url := func(n int) string {
+		return manifest.LocalizedPath(lang, paginatedPath(pattern, n))
+	}
+
+	pager := &Pager{
+		Items:      entries.Offset((number - 1) * perPage).Limit(perPage),
+		Current:    number,
+		Total:      total,
+		TotalItems: len(entries),
+		PerPage:    perPage,
+		FirstURL:   url(1),
+		LastURL:    url(total),
+	}
+	if number > 1 {
+		pager.PrevURL = url(number - 1)
+	}
+	if number < total {
+		pager.NextURL = url(number + 1)
+	}
+	for n := 1; n <= total; n++ {
+		pager.Pages = append(pager.Pages, PagerLink{Number: n, URL: url(n), IsCurrent: n == number})
+	}
+
+	return pager
+}
+
+// expandPaginatedRoutes adds the numbered pages after the first of every
+// paginated route, in every language
+func expandPaginatedRoutes(site *Site) {
+	manifest := site.Manifest
+
+	for _, route := range manifest.Routes {
+		if route.Paginate == nil {
+			continue
+		}
+
+		entries := site.Collections[route.Paginate.Collection]
+		for _, lang := range manifest.Languages() {
+			total := pageCount(len(entries.Lang(lang)), perPage(route.Paginate))
+			for n := 2; n <= total; n++ {
+				pageRoute := route
+				pageRoute.Path = paginatedPath(route.Path, n)
+
+				site.addLocalizedPage(PageRoute{
+					Route:      pageRoute,
+					Lang:       lang,
+					Pattern:    route.Path,
+					PageNumber: n,
+				})
+			}
+		}
+	}
+}
+
+// paginatedPath is the path of page n of a route, the first page is the
+// route itself
+func paginatedPath(path string, n int) string {
+	if n <= 1 {
+		return path
+	}
+	return strings.TrimSuffix(path, "/") + "/page/" + strconv.Itoa(n)
+}
+
+func pageCount(items int, perPage int) int {
+	if items == 0 {
+		return 1
+	}
+	return (items + perPage - 1) / perPage
+}
+
+func perPage(paginate *config.Paginate) int {
+	if paginate.PerPage > 0 {
+		return paginate.PerPage
+	}
+	return defaultPerPage
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/ZacxDev/go-static-site/config"
+	"github.com/gobuffalo/helpers/hctx"
+	"github.com/gobuffalo/plush"
+)
+
+// partialRenderer renders partials called with arguments, such as
+// partial("card", {"title": "Docs"}). Unlike partials without arguments,
+// which are spliced into the calling template, they are rendered when the
+// call is executed, in a child of the caller's context
+type partialRenderer struct {
+	route    config.Route
+	manifest *config.SiteManifest
+	deps     *dependencySet
+	// chain is the stack of partials being rendered, outermost first
+	chain []string
+}
+
+func newPartialRenderer(route config.Route, manifest *config.SiteManifest, deps *dependencySet) *partialRenderer {
+	return &partialRenderer{route: route, manifest: manifest, deps: deps}
+}
+
+// render is the partial helper. data is set onto the partial's own context,
+// values set while rendering the partial don't leak back to the caller
+func (pr *partialRenderer) render(name string, data map[string]interface{}, help plush.HelperContext) (template.HTML, error) {
+	pctx := NewPartialProcessingContext()
+	for _, rendering := range pr.chain {
+		if rendering == name {
+			return "", fmt.Errorf("circular dependency detected in partial: %s", name)
+		}
+		pctx.ProcessedPartials[rendering] = true
+	}
+	if len(pr.chain) >= pctx.MaxDepth {
+		return "", fmt.Errorf("maximum partial nesting depth (%d) exceeded", pctx.MaxDepth)
+	}
+
+	partial, err := lookupPartial(name, pr.route, pr.manifest)
+	if err != nil {
+		return "", err
+	}
+
+	pr.chain = append(pr.chain, name)
+	defer func() {
+		pr.chain = pr.chain[:len(pr.chain)-1]
+	}()
+
+	ctx := childContext(help)
+	for k, v := range data {
+		ctx.Set(k, v)
+	}
+	pctx.CurrentDepth = len(pr.chain)
+	pctx.Chain = append([]string(nil), pr.chain...)
+	pctx.shortcodes = newShortcodeRenderer(pr.manifest, ctx, pr.deps)
+
+	pr.deps.add(partial.Source)
+	content, _, err := loadPartial(pr.manifest, partial, pctx.shortcodes)
+	if err != nil {
+		return "", err
+	}
+
+	// Partials without arguments inside the partial are still spliced in
+	preprocessed, err := PreprocessTemplate(content, pr.route, pr.manifest, pctx)
+	for _, include := range pctx.Includes {
+		pr.deps.add(include.Source)
+	}
+	if err != nil {
+		return "", &RenderError{
+			File:         partial.Source,
+			Message:      err.Error(),
+			PartialChain: pctx.Chain,
+			Err:          err,
+		}
+	}
+
+	out, err := execTemplate(partial.Source, content, preprocessed, pctx, ctx)
+	if err != nil {
+		if re, ok := err.(*RenderError); ok && len(re.PartialChain) == 0 {
+			re.PartialChain = append([]string(nil), pr.chain...)
+		}
+		return "", err
+	}
+	return template.HTML(strings.TrimSuffix(out, "\n")), nil
+}
+
+// childContext returns a child of parent for rendering partials and
+// shortcodes. Child contexts are seeded with plush's builtin helpers, which
+// would shadow the site's own helpers of the same name, so those are copied
+// down from parent
+func childContext(parent hctx.Context) *plush.Context {
+	ctx := parent.New().(*plush.Context)
+	for name := range plush.Helpers.Helpers() {
+		if v := parent.Value(name); v != nil {
+			ctx.Set(name, v)
+		}
+	}
+	return ctx
+}
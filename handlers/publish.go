@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+)
+
+// PublishOptions decides which pages of dynamic routes are published based
+// on their draft, publish_date and expiry_date frontmatter. The zero value
+// publishes only live content
+type PublishOptions struct {
+	// Drafts includes pages with draft: true
+	Drafts bool
+	// Future includes pages whose publish_date hasn't been reached
+	Future bool
+}
+
+// isPublished reports whether a page with the given frontmatter is live at
+// now. Pages past their expiry_date are never published
+func (o PublishOptions) isPublished(meta *PageMeta, now time.Time) (bool, error) {
+	switch draft := meta.Get("draft").(type) {
+	case nil:
+	case bool:
+		if draft && !o.Drafts {
+			return false, nil
+		}
+	default:
+		return false, fmt.Errorf("draft must be true or false, got %v", draft)
+	}
+
+	if meta.Has("publish_date") {
+		if !meta.HasDate("publish_date") {
+			return false, fmt.Errorf("invalid publish_date %q", meta.String("publish_date"))
+		}
+		if meta.Date("publish_date").After(now) && !o.Future {
+			return false, nil
+		}
+	}
+
+	if meta.Has("expiry_date") {
+		if !meta.HasDate("expiry_date") {
+			return false, fmt.Errorf("invalid expiry_date %q", meta.String("expiry_date"))
+		}
+		if !meta.Date("expiry_date").After(now) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ZacxDev/go-static-site/javascript"
+	"github.com/pkg/errors"
+)
+
+// excerptContext is how many lines around the failing line are shown
+const excerptContext = 3
+
+// RenderError describes a template failure precisely enough to point at the
+// offending source, Line and Column are 0 when unknown
+type RenderError struct {
+	File         string
+	Line         int
+	Column       int
+	Message      string
+	Excerpt      []ExcerptLine
+	PartialChain []string
+	Err          error
+}
+
+// ExcerptLine is a single numbered line of source shown around an error
+type ExcerptLine struct {
+	Number    int
+	Text      string
+	IsFailing bool
+}
+
+func (e *RenderError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.File)
+	if e.Line > 0 {
+		fmt.Fprintf(&b, ":%d", e.Line)
+		if e.Column > 0 {
+			fmt.Fprintf(&b, ":%d", e.Column)
+		}
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Message)
+	if len(e.PartialChain) > 0 {
+		fmt.Fprintf(&b, " (included via %s)", strings.Join(e.PartialChain, " > "))
+	}
+	return b.String()
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+var plushLineRe = regexp.MustCompile(`line (\d+): `)
+
+// newTemplateError maps a plush error on preprocessed content back to the
+// file it came from. Partials are spliced in before parsing so plush line
+// numbers refer to the combined template, the failing line is looked up in
+// the original source and then in every included partial
+func newTemplateError(
+	source string,
+	content string,
+	preprocessed string,
+	partials *PartialProcessingContext,
+	err error,
+) *RenderError {
+	re := &RenderError{File: source, Message: err.Error(), Err: err}
+
+	m := plushLineRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return re
+	}
+	line, _ := strconv.Atoi(m[1])
+	re.Message = strings.Replace(err.Error(), m[0], "", 1)
+
+	lines := strings.Split(preprocessed, "\n")
+	if line < 1 || line > len(lines) {
+		return re
+	}
+	failing := lines[line-1]
+
+	// No partials before the failing line means line numbers still match
+	sourceLines := strings.Split(content, "\n")
+	if line <= len(sourceLines) && sourceLines[line-1] == failing {
+		re.Line = line
+		re.Excerpt = excerpt(sourceLines, line)
+		return re
+	}
+
+	if partials != nil && strings.TrimSpace(failing) != "" {
+		for i := len(partials.Includes) - 1; i >= 0; i-- {
+			include := partials.Includes[i]
+			includeLines := strings.Split(include.Content, "\n")
+			for n, l := range includeLines {
+				if l == failing {
+					re.File = include.Source
+					re.Line = n + 1
+					re.Excerpt = excerpt(includeLines, n+1)
+					re.PartialChain = include.Chain
+					return re
+				}
+			}
+		}
+	}
+
+	// Fall back to what plush actually saw, the line doesn't exist in source
+	// so the location is labeled as the preprocessed template. A partial
+	// spliced into the middle of a line still shows up in the chain
+	re.File = source + " (preprocessed)"
+	re.Line = line
+	re.Excerpt = excerpt(lines, line)
+	if partials != nil {
+		re.PartialChain = splicedChain(partials.Includes, failing)
+	}
+	return re
+}
+
+// splicedChain returns the chain of the innermost partial with a line that
+// is part of failing
+func splicedChain(includes []PartialInclude, failing string) []string {
+	for i := len(includes) - 1; i >= 0; i-- {
+		for _, l := range strings.Split(includes[i].Content, "\n") {
+			if strings.TrimSpace(l) != "" && strings.Contains(failing, l) {
+				return includes[i].Chain
+			}
+		}
+	}
+	return nil
+}
+
+// offsetRenderError shifts the line of an error in source by offset, for
+// templates executed without their leading frontmatter
+func offsetRenderError(err error, source string, offset int) error {
+	re, ok := err.(*RenderError)
+	if !ok || offset == 0 || re.File != source || re.Line == 0 {
+		return err
+	}
+	re.Line += offset
+	re.Excerpt = excerptFromFile(source, re.Line)
+	return re
+}
+
+// withSource attributes an error found in content that wasn't read from a
+// file yet, such as a malformed shortcode, to source
+func withSource(err error, source string) error {
+	re, ok := err.(*RenderError)
+	if !ok || re.File != "" {
+		return err
+	}
+	re.File = source
+	re.Excerpt = excerptFromFile(source, re.Line)
+	return re
+}
+
+func excerpt(lines []string, line int) []ExcerptLine {
+	start := line - excerptContext
+	if start < 1 {
+		start = 1
+	}
+	end := line + excerptContext
+	if end > len(lines) {
+		end = len(lines)
+	}
+
+	var out []ExcerptLine
+	for n := start; n <= end; n++ {
+		out = append(out, ExcerptLine{
+			Number:    n,
+			Text:      lines[n-1],
+			IsFailing: n == line,
+		})
+	}
+	return out
+}
+
+// excerptFromFile reads an excerpt around line from file, returning nil if
+// the file can't be read
+func excerptFromFile(file string, line int) []ExcerptLine {
+	data, err := os.ReadFile(file)
+	if err != nil || line < 1 {
+		return nil
+	}
+	return excerpt(strings.Split(string(data), "\n"), line)
+}
+
+var overlayTemplate = template.Must(template.New("overlay").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Build error</title>
+<style>
+  body { margin: 0; background: #1e1e1e; color: #e6e6e6; font: 14px/1.5 ui-monospace, Menlo, Consolas, monospace; }
+  main { max-width: 960px; margin: 0 auto; padding: 32px; }
+  h1 { color: #ff6b6b; font-size: 18px; margin: 0 0 8px; }
+  .location { color: #9cdcfe; margin-bottom: 16px; }
+  .message { white-space: pre-wrap; background: #2d2d2d; border-left: 4px solid #ff6b6b; padding: 12px 16px; margin: 0 0 16px; }
+  .chain { color: #c5a5ff; margin-bottom: 16px; }
+  pre { background: #252526; padding: 12px 0; overflow-x: auto; margin: 0 0 16px; }
+  .line { display: block; padding: 0 16px; }
+  .line.failing { background: #5a1d1d; }
+  .number { display: inline-block; width: 4em; color: #858585; user-select: none; }
+  h2 { font-size: 15px; color: #dcdcaa; margin: 24px 0 8px; }
+  footer { color: #858585; margin-top: 24px; }
+</style>
+</head>
+<body>
+<main>
+  <h1>{{.Title}}</h1>
+  {{with .Render}}
+    {{if .File}}<div class="location">{{.File}}{{if .Line}}:{{.Line}}{{if .Column}}:{{.Column}}{{end}}{{end}}</div>{{end}}
+    <div class="message">{{.Message}}</div>
+    {{if .PartialChain}}<div class="chain">Included via partials: {{range $i, $p := .PartialChain}}{{if $i}} &rarr; {{end}}{{$p}}{{end}}</div>{{end}}
+    {{if $.Excerpt}}<pre>{{range $.Excerpt}}<span class="line{{if .IsFailing}} failing{{end}}"><span class="number">{{.Number}}</span>{{.Text}}</span>{{end}}</pre>{{end}}
+  {{else}}
+    <div class="message">{{.Message}}</div>
+  {{end}}
+  {{with .Javascript}}
+    <h2>esbuild: {{.Target}}</h2>
+    {{range .Diagnostics}}
+      <div class="location">{{if .File}}{{.File}}:{{.Line}}:{{.Column}}{{end}}</div>
+      <div class="message">{{.Text}}</div>
+      {{if .LineText}}<pre><span class="line failing"><span class="number">{{.Line}}</span>{{.LineText}}</span></pre>{{end}}
+    {{end}}
+  {{end}}
+  <footer>This page will reload once the error is fixed.</footer>
+</main>
+</body>
+</html>
+`))
+
+// WriteErrorOverlay responds with an HTML page describing err, pointing at
+// the failing source when err is a RenderError or javascript BuildError
+func WriteErrorOverlay(w http.ResponseWriter, err error) {
+	data := struct {
+		Title      string
+		Message    string
+		Render     *RenderError
+		Excerpt    []ExcerptLine
+		Javascript *javascript.BuildError
+	}{
+		Title:   "Error rendering page",
+		Message: err.Error(),
+	}
+
+	var renderErr *RenderError
+	if errors.As(err, &renderErr) {
+		// The error may be shared by concurrent requests, so it is only read
+		data.Render = renderErr
+		data.Excerpt = renderErr.Excerpt
+		if data.Excerpt == nil {
+			data.Excerpt = excerptFromFile(renderErr.File, renderErr.Line)
+		}
+	}
+
+	var jsErr *javascript.BuildError
+	if errors.As(err, &jsErr) {
+		data.Title = "Error compiling javascript"
+		data.Javascript = jsErr
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusInternalServerError)
+
+	err = overlayTemplate.Execute(w, data)
+	if err != nil {
+		fmt.Fprintf(w, "Error rendering error overlay: %v", err)
+	}
+}
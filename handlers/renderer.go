@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ZacxDev/go-static-site/config"
+	"github.com/gobuffalo/plush"
+	"github.com/pkg/errors"
+)
+
+// PageRoute is a single concrete page: a manifest route rendered in one
+// language at one URL
+type PageRoute struct {
+	Route   config.Route
+	Lang    string
+	URLPath string
+	Params  map[string]string
+
+	// Pattern is the manifest path the page was expanded from, e.g. /blog/:slug
+	Pattern string
+
+	// PageNumber is the page of a paginated route, 0 or 1 for the first
+	PageNumber int `json:",omitempty"`
+
+	// Taxonomy is set on generated taxonomy pages, along with the Term slug
+	// on term pages
+	Taxonomy string `json:",omitempty"`
+	Term     string `json:",omitempty"`
+}
+
+// Page is the output of rendering a PageRoute
+type Page struct {
+	Body         []byte
+	Status       int
+	ContentType  string
+	Dependencies []string
+}
+
+// Renderer renders pages in-process without going through an HTTP server.
+// It holds no mutable state so Render is safe to call concurrently
+type Renderer struct {
+	manifest         *config.SiteManifest
+	emittedJS        map[string]string
+	translations     map[string]map[string]string
+	registeredRoutes []string
+	collections      map[string]Entries
+}
+
+// NewRenderer creates a renderer for the given manifest and its compiled assets
+func NewRenderer(
+	manifest *config.SiteManifest,
+	emittedJS map[string]string,
+	translations map[string]map[string]string,
+	registeredRoutes []string,
+	collections map[string]Entries,
+) *Renderer {
+	return &Renderer{
+		manifest:         manifest,
+		emittedJS:        emittedJS,
+		translations:     translations,
+		registeredRoutes: registeredRoutes,
+		collections:      collections,
+	}
+}
+
+// Render produces the page for a route in the given language
+func (rn *Renderer) Render(page PageRoute) (*Page, error) {
+	deps := newDependencySet()
+	ctx, content, err := rn.renderContent(page, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	pageHtml, err := rn.renderLayouts(rn.pageLayout(page, ctx), content, page.Route, ctx, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Page{
+		Body:         []byte(pageHtml),
+		Status:       http.StatusOK,
+		ContentType:  "text/html; charset=utf-8",
+		Dependencies: deps.list(),
+	}, nil
+}
+
+// pageLayout is the layout a page is rendered into, a layout key in the
+// page's frontmatter takes precedence over the route and manifest defaults
+func (rn *Renderer) pageLayout(page PageRoute, ctx *plush.Context) string {
+	if meta, ok := ctx.Value("page").(*PageMeta); ok && meta.String("layout") != "" {
+		return config.LayoutSource(meta.String("layout"))
+	}
+	return rn.manifest.RouteLayout(page.Route)
+}
+
+// renderLayouts renders content into layout, then the result into the
+// layout's parent, until reaching a layout without a parent. Each layout
+// sees the output of the one below it as yield and shares the page's
+// context, so contentFor blocks filled by the page or an inner layout can be
+// placed by any outer layout with contentOf
+func (rn *Renderer) renderLayouts(layout string, content string, route config.Route, ctx *plush.Context, deps *dependencySet) (string, error) {
+	var chain []string
+	for layout != "" {
+		for _, seen := range chain {
+			if seen == layout {
+				return "", fmt.Errorf("circular layout: %s", strings.Join(append(chain, layout), " -> "))
+			}
+		}
+		if len(chain) >= config.MaxLayoutDepth {
+			return "", fmt.Errorf("maximum layout nesting depth (%d) exceeded", config.MaxLayoutDepth)
+		}
+		chain = append(chain, layout)
+
+		deps.add(layout)
+		source, _, err := templates.readFile(layout)
+		if err != nil {
+			return "", errors.Wrapf(err, "error reading layout %s", layout)
+		}
+
+		doc, err := parseFrontmatter(layout, source)
+		if err != nil {
+			return "", err
+		}
+
+		ctx.Set("yield", template.HTML(content))
+
+		preprocessed, partials, err := preprocessSource(layout, doc.Body, route, rn.manifest, ctx, deps)
+		if err != nil {
+			return "", errors.Wrapf(err, "error preprocessing layout %s", layout)
+		}
+
+		content, err = execTemplate(layout, doc.Body, preprocessed, partials, ctx)
+		if err != nil {
+			return "", errors.Wrapf(offsetRenderError(err, layout, doc.BodyLine-1), "error executing layout %s", layout)
+		}
+
+		parent, _ := doc.Params["layout"].(string)
+		layout = config.LayoutSource(parent)
+	}
+	return content, nil
+}
+
+// RenderContent renders a page's own content without its layout, e.g.
+// for the full content of feed items
+func (rn *Renderer) RenderContent(page PageRoute) (string, error) {
+	_, content, err := rn.renderContent(page, newDependencySet())
+	return content, err
+}
+
+// renderContent sets up the template context of a page and renders its
+// source, returning the context for the layout to be rendered with
+func (rn *Renderer) renderContent(page PageRoute, deps *dependencySet) (*plush.Context, string, error) {
+	route := page.Route
+	lang := page.Lang
+
+	ctx := plush.NewContext()
+	params := page.Params
+	if params == nil {
+		params = map[string]string{}
+	}
+	ctx.Set("params", params)
+	ctx.Set("registeredRoutes", rn.registeredRoutes)
+
+	// Add translation helper
+	ctx.Set("text", func(key string) string {
+		if t, ok := rn.translations[lang][key]; ok {
+			return t
+		}
+		return key
+	})
+	for _, tr := range rn.manifest.Translations {
+		if tr.Code == lang {
+			deps.add(tr.Source)
+		}
+	}
+
+	ctx.Set("lang", lang)
+
+	ctx.Set("supportedLangs", rn.manifest.Languages())
+	ctx.Set("defaultLang", rn.manifest.DefaultLanguage())
+	ctx.Set("appOrigin", os.Getenv("APP_ORIGIN"))
+
+	// Pass in javascript bundle paths
+	for _, tsDepLabl := range route.JavascriptDeps {
+		for label, publicPath := range rn.emittedJS {
+			if label == tsDepLabl {
+				ctx.Set(tsDepLabl, publicPath)
+			}
+		}
+		deps.add(rn.manifest.JavascriptTargets[tsDepLabl].Source)
+	}
+
+	// Add helper functions
+	ctx.Set("startsWith", func(s string, prefix string) bool {
+		return strings.HasPrefix(s, prefix)
+	})
+
+	ctx.Set("matches", func(s string, pat string) bool {
+		re := regexp.MustCompile(pat)
+		return re.Match([]byte(s))
+	})
+
+	ctx.Set("replace", func(s string, old string, n string) string {
+		return strings.Replace(s, old, n, 1)
+	})
+
+	ctx.Set("replaceAll", func(s string, old string, n string) string {
+		return strings.ReplaceAll(s, old, n)
+	})
+
+	ctx.Set("replacePattern", func(s string, pat, n string) string {
+		re := regexp.MustCompile(pat)
+		return re.ReplaceAllString(s, n)
+	})
+
+	// Add canonical URL helper
+	ctx.Set("canonical", rn.manifest.URL(rn.manifest.LocalizedPath(lang, route.Path)))
+	ctx.Set("localizedPath", rn.manifest.LocalizedPath)
+
+	ctx.Set("currentPath", page.URLPath)
+
+	// Collection entries in the page's language, listing pages are rebuilt
+	// whenever one of the entries they query changes
+	ctx.Set("collection", func(name string) (Entries, error) {
+		entries, ok := rn.collections[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown collection %s", name)
+		}
+		for _, entry := range entries {
+			deps.add(entry.Source)
+		}
+		return entries.Lang(lang), nil
+	})
+	setCollectionHelpers(ctx)
+
+	// Autodiscovery links for every feed in the page's language
+	ctx.Set("feedLinks", func() template.HTML {
+		return feedLinks(rn.manifest, rn.translations, lang)
+	})
+
+	// Partials called with arguments render in their own context
+	ctx.Set("partial", newPartialRenderer(route, rn.manifest, deps).render)
+
+	// Markdown pages replace the table of contents with their headings
+	ctx.Set("toc", &TableOfContents{})
+	ctx.Set("tocHTML", func(help plush.HelperContext) template.HTML {
+		toc, _ := help.Value("toc").(*TableOfContents)
+		if toc == nil {
+			return ""
+		}
+		return toc.HTML()
+	})
+
+	// Stylesheet link of class based syntax highlighting
+	ctx.Set("highlightStylesheet", func() template.HTML {
+		return highlightStylesheetLink(rn.manifest)
+	})
+
+	// Terms of a taxonomy in the page's language, e.g. for a tag cloud
+	ctx.Set("taxonomy", func(name string) (*Taxonomy, error) {
+		tc, ok := rn.manifest.Taxonomies[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown taxonomy %s", name)
+		}
+		for _, entry := range rn.collections[tc.Collection] {
+			deps.add(entry.Source)
+		}
+		return buildTaxonomy(rn.manifest, name, lang, rn.collections), nil
+	})
+
+	if page.Taxonomy != "" {
+		taxonomy := buildTaxonomy(rn.manifest, page.Taxonomy, lang, rn.collections)
+		for _, entry := range rn.collections[rn.manifest.Taxonomies[page.Taxonomy].Collection] {
+			deps.add(entry.Source)
+		}
+		ctx.Set("currentTaxonomy", taxonomy)
+		if page.Term != "" {
+			ctx.Set("term", taxonomy.Get(page.Term))
+		}
+	}
+
+	if route.Paginate != nil {
+		entries := rn.collections[route.Paginate.Collection].Lang(lang)
+		for _, entry := range entries {
+			deps.add(entry.Source)
+		}
+		ctx.Set("pager", newPager(rn.manifest, lang, page.Pattern, route.Paginate, entries, page.PageNumber))
+	}
+
+	var content string
+	var err error
+
+	deps.add(route.Source)
+	switch route.TemplateType {
+	case "PLUSH":
+		content, _, err = renderPlushTemplate(route.Source, route, rn.manifest, ctx, deps)
+	case "MARKDOWN":
+		content, _, err = renderMarkdownTemplate(route.Source, route, rn.manifest, ctx, deps)
+	default:
+		return nil, "", fmt.Errorf("unsupported template type: %s", route.TemplateType)
+	}
+
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error rendering template")
+	}
+
+	return ctx, content, nil
+}
+
+// Fingerprint summarizes every input of a page that isn't a source file:
+// the route config, site wide values exposed to templates and the emitted
+// javascript bundle paths. Together with the page's dependency hashes it
+// decides whether a cached page can be reused
+func (rn *Renderer) Fingerprint(page PageRoute) string {
+	js := make(map[string]string)
+	for _, label := range page.Route.JavascriptDeps {
+		js[label] = rn.emittedJS[label]
+	}
+
+	data, _ := json.Marshal(struct {
+		Page             PageRoute
+		Origin           string
+		AppOrigin        string
+		Translations     []config.Translation
+		I18n             config.I18n
+		Partials         map[string]config.Partial
+		Collections      map[string]config.Collection
+		Taxonomies       map[string]config.Taxonomy
+		Feeds            map[string]config.Feed
+		DefaultLayout    string
+		Markdown         config.Markdown
+		Shortcodes       map[string]config.Shortcode
+		RegisteredRoutes []string
+		JS               map[string]string
+	}{
+		Page:             page,
+		Origin:           rn.manifest.Origin,
+		AppOrigin:        os.Getenv("APP_ORIGIN"),
+		Translations:     rn.manifest.Translations,
+		I18n:             rn.manifest.I18n,
+		Partials:         rn.manifest.Partials,
+		Collections:      rn.manifest.Collections,
+		Taxonomies:       rn.manifest.Taxonomies,
+		Feeds:            rn.manifest.Feeds,
+		DefaultLayout:    rn.manifest.DefaultLayout,
+		Markdown:         rn.manifest.Markdown,
+		Shortcodes:       rn.manifest.Shortcodes,
+		RegisteredRoutes: rn.registeredRoutes,
+		JS:               js,
+	})
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// dependencySet collects the source files read while rendering a page
+type dependencySet struct {
+	seen  map[string]bool
+	files []string
+}
+
+func newDependencySet() *dependencySet {
+	return &dependencySet{seen: make(map[string]bool)}
+}
+
+func (d *dependencySet) add(files ...string) {
+	for _, f := range files {
+		if f == "" || d.seen[f] {
+			continue
+		}
+		d.seen[f] = true
+		d.files = append(d.files, f)
+	}
+}
+
+func (d *dependencySet) list() []string {
+	return d.files
+}
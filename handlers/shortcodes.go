@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ZacxDev/go-static-site/config"
+	"github.com/gobuffalo/plush"
+	"github.com/pkg/errors"
+)
+
+var (
+	// shortcodeTagPattern matches a single shortcode tag, e.g.
+	// {{< callout type="warning" >}}, {{< /callout >}} or {{< icon name=x />}}
+	shortcodeTagPattern  = regexp.MustCompile(`\{\{<([^\n]*?)>\}\}`)
+	shortcodeNamePattern = regexp.MustCompile(`^[A-Za-z][\w-]*`)
+	shortcodeArgPattern  = regexp.MustCompile(`^([A-Za-z_][\w-]*)=(?:"((?:[^"\\]|\\.)*)"|([^\s"]+))`)
+)
+
+// shortcodePlaceholder stands in for rendered shortcodes while markdown is
+// converted, so their HTML isn't parsed as markdown
+const shortcodePlaceholder = "GSSSHORTCODE%dX"
+
+// shortcodeRenderer renders the shortcodes of markdown content with the
+// template context of the page being rendered
+type shortcodeRenderer struct {
+	manifest *config.SiteManifest
+	ctx      *plush.Context
+	deps     *dependencySet
+
+	// rendered is set once a shortcode was rendered
+	rendered bool
+}
+
+func newShortcodeRenderer(manifest *config.SiteManifest, ctx *plush.Context, deps *dependencySet) *shortcodeRenderer {
+	return &shortcodeRenderer{manifest: manifest, ctx: ctx, deps: deps}
+}
+
+type shortcodeTag struct {
+	name        string
+	args        map[string]string
+	closing     bool
+	selfClosing bool
+}
+
+// expand replaces every shortcode in md with a placeholder, returning the
+// rendered HTML of each. firstLine is the line md starts at in its source,
+// for error messages. Shortcodes escaped as {{</* name */>}} are written out
+// as is
+func (sc *shortcodeRenderer) expand(md string, firstLine int) (string, []string, error) {
+	var out strings.Builder
+	var rendered []string
+
+	pos := 0
+	for {
+		loc := shortcodeTagPattern.FindStringSubmatchIndex(md[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[0], pos+loc[1]
+		body := md[pos+loc[2] : pos+loc[3]]
+		line := firstLine + strings.Count(md[:start], "\n")
+		out.WriteString(md[pos:start])
+
+		trimmed := strings.TrimSpace(body)
+		if strings.HasPrefix(trimmed, "/*") && strings.HasSuffix(trimmed, "*/") {
+			out.WriteString("{{< " + strings.TrimSpace(trimmed[2:len(trimmed)-2]) + " >}}")
+			pos = end
+			continue
+		}
+
+		tag, err := parseShortcodeTag(body)
+		if err != nil {
+			return "", nil, &RenderError{Line: line, Message: err.Error(), Err: err}
+		}
+		if tag.closing {
+			err := fmt.Errorf("unexpected closing shortcode %s", tag.name)
+			return "", nil, &RenderError{Line: line, Message: err.Error(), Err: err}
+		}
+
+		var inner *string
+		if !tag.selfClosing {
+			if closeStart, closeEnd, ok := findClosingShortcode(md, end, tag.name); ok {
+				content := md[end:closeStart]
+				inner = &content
+				end = closeEnd
+			}
+		}
+
+		html, err := sc.render(tag, inner, line)
+		if err != nil {
+			if re, ok := err.(*RenderError); ok && re.File == "" && re.Line == 0 {
+				re.Line = line
+			}
+			return "", nil, err
+		}
+
+		fmt.Fprintf(&out, shortcodePlaceholder, len(rendered))
+		rendered = append(rendered, html)
+		pos = end
+	}
+	out.WriteString(md[pos:])
+
+	return out.String(), rendered, nil
+}
+
+// restoreShortcodes puts rendered shortcodes back in place of their placeholders,
+// dropping the paragraph markdown wraps a shortcode on its own line in
+func restoreShortcodes(html []byte, rendered []string) []byte {
+	s := string(html)
+	for i, sc := range rendered {
+		placeholder := fmt.Sprintf(shortcodePlaceholder, i)
+		s = strings.Replace(s, "<p>"+placeholder+"</p>", sc, 1)
+		s = strings.Replace(s, placeholder, sc, 1)
+	}
+	return []byte(s)
+}
+
+// render executes a shortcode's template in a child of the page's context
+// with its arguments set by name and as args, and its inner content
+// rendered as markdown as inner. line is where the shortcode starts
+func (sc *shortcodeRenderer) render(tag shortcodeTag, inner *string, line int) (string, error) {
+	shortcode, ok := sc.manifest.Shortcodes[tag.name]
+	if !ok {
+		err := fmt.Errorf("unknown shortcode %s", tag.name)
+		return "", &RenderError{Message: err.Error(), Err: err}
+	}
+
+	ctx := childContext(sc.ctx)
+	for name, value := range tag.args {
+		ctx.Set(name, value)
+	}
+	ctx.Set("args", tag.args)
+	ctx.Set("inner", template.HTML(""))
+	if inner != nil {
+		html, _, err := renderMarkdownAt(sc.manifest, []byte(*inner), sc, line)
+		if err != nil {
+			return "", err
+		}
+		ctx.Set("inner", template.HTML(strings.TrimSpace(string(html))))
+	}
+
+	sc.rendered = true
+	sc.deps.add(shortcode.Source)
+	source, _, err := templates.readFile(shortcode.Source)
+	if err != nil {
+		return "", errors.Wrapf(err, "error reading shortcode %s", tag.name)
+	}
+	out, err := execTemplate(shortcode.Source, string(source), string(source), NewPartialProcessingContext(), ctx)
+	if err != nil {
+		return "", err
+	}
+	// Trailing newlines of the template would break inline shortcodes
+	return strings.TrimSpace(out), nil
+}
+
+// parseShortcodeTag parses the inside of {{< ... >}}
+func parseShortcodeTag(body string) (shortcodeTag, error) {
+	tag := shortcodeTag{args: map[string]string{}}
+	rest := strings.TrimSpace(body)
+
+	if strings.HasSuffix(rest, "/") {
+		tag.selfClosing = true
+		rest = strings.TrimSpace(strings.TrimSuffix(rest, "/"))
+	}
+	if strings.HasPrefix(rest, "/") {
+		tag.closing = true
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, "/"))
+	}
+
+	tag.name = shortcodeNamePattern.FindString(rest)
+	if tag.name == "" {
+		return tag, fmt.Errorf("invalid shortcode {{<%s>}}, expected a name", body)
+	}
+	rest = strings.TrimSpace(rest[len(tag.name):])
+
+	for rest != "" {
+		m := shortcodeArgPattern.FindStringSubmatch(rest)
+		if m == nil {
+			return tag, fmt.Errorf("invalid arguments for shortcode %s: %s", tag.name, rest)
+		}
+		value := m[3]
+		if m[3] == "" {
+			unquoted, err := strconv.Unquote(`"` + m[2] + `"`)
+			if err != nil {
+				return tag, fmt.Errorf("invalid value for %s in shortcode %s: %v", m[1], tag.name, err)
+			}
+			value = unquoted
+		}
+		tag.args[m[1]] = value
+		rest = strings.TrimSpace(rest[len(m[0]):])
+	}
+	if tag.closing && len(tag.args) > 0 {
+		return tag, fmt.Errorf("closing shortcode %s can't have arguments", tag.name)
+	}
+
+	return tag, nil
+}
+
+// findClosingShortcode finds the tag closing a shortcode opened before
+// from, skipping pairs of the same shortcode nested inside it
+func findClosingShortcode(md string, from int, name string) (int, int, bool) {
+	depth := 0
+	for _, loc := range shortcodeTagPattern.FindAllStringSubmatchIndex(md[from:], -1) {
+		tag, err := parseShortcodeTag(md[from+loc[2] : from+loc[3]])
+		if err != nil || tag.name != name || tag.selfClosing {
+			continue
+		}
+		if !tag.closing {
+			depth++
+			continue
+		}
+		if depth == 0 {
+			return from + loc[0], from + loc[1], true
+		}
+		depth--
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ZacxDev/go-static-site/config"
+)
+
+// Taxonomy is the set of terms a taxonomy collects in one language, sorted
+// by name
+type Taxonomy struct {
+	Name  string
+	URL   string
+	Terms []*Term
+}
+
+// Term is a single taxonomy term with the entries listing it
+type Term struct {
+	Name    string
+	Slug    string
+	URL     string
+	Count   int
+	Entries Entries
+}
+
+var slugInvalidPattern = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// slugify turns a term into a URL path segment: "Static Sites" -> static-sites
+func slugify(s string) string {
+	return strings.Trim(slugInvalidPattern.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// buildTaxonomy collects the terms of the taxonomy called name from the
+// entries of its collection in lang. Terms are matched by slug, the first
+// spelling seen is used as the term's name
+func buildTaxonomy(manifest *config.SiteManifest, name string, lang string, collections map[string]Entries) *Taxonomy {
+	tc := manifest.Taxonomies[name]
+	base := tc.RoutePath(name)
+	key := tc.TermsKey(name)
+
+	taxonomy := &Taxonomy{
+		Name: name,
+		URL:  manifest.LocalizedPath(lang, base),
+	}
+	bySlug := make(map[string]*Term)
+	for _, entry := range collections[tc.Collection].Lang(lang) {
+		for _, value := range entry.Strings(key) {
+			slug := slugify(value)
+			if slug == "" {
+				continue
+			}
+			term, ok := bySlug[slug]
+			if !ok {
+				term = &Term{
+					Name:    value,
+					Slug:    slug,
+					URL:     manifest.LocalizedPath(lang, termPath(base, slug)),
+					Entries: Entries{},
+				}
+				bySlug[slug] = term
+				taxonomy.Terms = append(taxonomy.Terms, term)
+			}
+			if len(term.Entries) == 0 || term.Entries[len(term.Entries)-1] != entry {
+				term.Entries = append(term.Entries, entry)
+				term.Count++
+			}
+		}
+	}
+
+	sort.SliceStable(taxonomy.Terms, func(i, j int) bool {
+		return strings.ToLower(taxonomy.Terms[i].Name) < strings.ToLower(taxonomy.Terms[j].Name)
+	})
+
+	return taxonomy
+}
+
+// Get returns the term with the given slug, or nil
+func (t *Taxonomy) Get(slug string) *Term {
+	for _, term := range t.Terms {
+		if term.Slug == slug {
+			return term
+		}
+	}
+	return nil
+}
+
+// ByCount returns the terms ordered from most to least used
+func (t *Taxonomy) ByCount() []*Term {
+	terms := append([]*Term(nil), t.Terms...)
+	sort.SliceStable(terms, func(i, j int) bool {
+		return terms[i].Count > terms[j].Count
+	})
+	return terms
+}
+
+// expandTaxonomyRoutes adds the terms index and a page per term of every
+// taxonomy, in every language
+func expandTaxonomyRoutes(site *Site) {
+	manifest := site.Manifest
+
+	for _, name := range config.SortedKeys(manifest.Taxonomies) {
+		tc := manifest.Taxonomies[name]
+		base := tc.RoutePath(name)
+		pattern := termPath(base, ":"+name)
+
+		for _, lang := range manifest.Languages() {
+			if tc.IndexTemplate != "" {
+				site.addLocalizedPage(PageRoute{
+					Route:    taxonomyRoute(tc, base, tc.IndexTemplate),
+					Lang:     lang,
+					Pattern:  base,
+					Taxonomy: name,
+				})
+			}
+
+			for _, term := range buildTaxonomy(manifest, name, lang, site.Collections).Terms {
+				site.addLocalizedPage(PageRoute{
+					Route:    taxonomyRoute(tc, termPath(base, term.Slug), tc.TermTemplate),
+					Lang:     lang,
+					Params:   map[string]string{name: term.Slug},
+					Pattern:  pattern,
+					Taxonomy: name,
+					Term:     term.Slug,
+				})
+			}
+		}
+	}
+}
+
+func taxonomyRoute(tc config.Taxonomy, path string, source string) config.Route {
+	return config.Route{
+		Path:         path,
+		Source:       source,
+		TemplateType: "PLUSH",
+		PartialDeps:  tc.PartialDeps,
+		Layout:       tc.Layout,
+	}
+}
+
+func termPath(base string, slug string) string {
+	return strings.TrimSuffix(base, "/") + "/" + slug
+}
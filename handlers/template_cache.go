@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ZacxDev/go-static-site/config"
+	"github.com/gobuffalo/plush"
+)
+
+// templates caches what rendering reads from disk and derives from it. It
+// is shared by every site loaded in the process, so in serve it stays warm
+// across rebuilds and only changed files are read and parsed again
+var templates = newTemplateCache()
+
+// templateCache holds source files, preprocessed templates and parsed
+// templates keyed by source path. Files are checked against their
+// modification time and size, derived entries against a hash of the content
+// they were built from, so edits are picked up on the next render. There is
+// one entry per source path, which keeps the cache bounded by the size of
+// the site, unlike plush.Parse that caches every template it ever parsed
+type templateCache struct {
+	mu           sync.Mutex
+	files        map[string]*cachedFile
+	preprocessed map[string]*cachedPreprocess
+	parsed       map[string]*cachedTemplate
+
+	// settings is the hash of the manifest settings preprocessing depends
+	// on, computed once for the most recently loaded manifest
+	settings struct {
+		manifest *config.SiteManifest
+		hash     string
+	}
+}
+
+type cachedFile struct {
+	modTime time.Time
+	size    int64
+	content []byte
+	hash    string
+}
+
+// cachedPreprocess is a template with its partials spliced in. It is only
+// valid for manifests with the same partial, shortcode and markdown settings
+// and as long as the included partial files are unchanged
+type cachedPreprocess struct {
+	settings  string
+	hash      string
+	includes  []PartialInclude
+	processed string
+}
+
+type cachedTemplate struct {
+	hash     string
+	template *plush.Template
+}
+
+func newTemplateCache() *templateCache {
+	return &templateCache{
+		files:        make(map[string]*cachedFile),
+		preprocessed: make(map[string]*cachedPreprocess),
+		parsed:       make(map[string]*cachedTemplate),
+	}
+}
+
+// readFile returns the content of path and its hash, reading it again only
+// when it was modified since the last read. The content is shared and must
+// not be modified
+func (c *templateCache) readFile(path string) ([]byte, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		c.mu.Lock()
+		delete(c.files, path)
+		c.mu.Unlock()
+		return nil, "", err
+	}
+
+	c.mu.Lock()
+	file, ok := c.files[path]
+	c.mu.Unlock()
+	if ok && file.modTime.Equal(info.ModTime()) && file.size == info.Size() {
+		return file.content, file.hash, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	file = &cachedFile{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		content: content,
+		hash:    contentHash(string(content)),
+	}
+
+	c.mu.Lock()
+	c.files[path] = file
+	c.mu.Unlock()
+	return file.content, file.hash, nil
+}
+
+// preprocess returns the cached result of preprocessing content read from
+// source for route, along with the partials it includes
+func (c *templateCache) preprocess(source, content string, route config.Route, manifest *config.SiteManifest) (string, []PartialInclude, bool) {
+	c.mu.Lock()
+	entry, ok := c.preprocessed[source]
+	c.mu.Unlock()
+	if !ok || entry.settings != c.settingsHash(manifest) || entry.hash != contentHash(content) {
+		return "", nil, false
+	}
+
+	for _, include := range entry.includes {
+		// Routes have to declare every partial they include themselves
+		if _, err := lookupPartial(include.Name, route, manifest); err != nil {
+			return "", nil, false
+		}
+		if _, hash, err := c.readFile(include.Source); err != nil || hash != include.hash {
+			return "", nil, false
+		}
+	}
+	return entry.processed, entry.includes, true
+}
+
+// storePreprocessed caches the result of preprocessing content read from source
+func (c *templateCache) storePreprocessed(source, content string, manifest *config.SiteManifest, includes []PartialInclude, processed string) {
+	settings := c.settingsHash(manifest)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.preprocessed[source] = &cachedPreprocess{
+		settings:  settings,
+		hash:      contentHash(content),
+		includes:  includes,
+		processed: processed,
+	}
+}
+
+// parse returns the parsed template of preprocessed content of source.
+// Templates are only read while executing, so a cached template is shared
+// by concurrent renders
+func (c *templateCache) parse(source, preprocessed string) (*plush.Template, error) {
+	hash := contentHash(preprocessed)
+
+	c.mu.Lock()
+	entry, ok := c.parsed[source]
+	c.mu.Unlock()
+	if ok && entry.hash == hash {
+		return entry.template, nil
+	}
+
+	template, err := plush.NewTemplate(preprocessed)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.parsed[source] = &cachedTemplate{hash: hash, template: template}
+	c.mu.Unlock()
+	return template, nil
+}
+
+// settingsHash hashes the manifest settings preprocessed templates depend
+// on, so entries survive reloading an unchanged manifest in serve
+func (c *templateCache) settingsHash(manifest *config.SiteManifest) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.settings.manifest == manifest {
+		return c.settings.hash
+	}
+
+	// The settings are plain values, marshaling them can't fail
+	settings, _ := json.Marshal(struct {
+		Partials   map[string]config.Partial
+		Shortcodes map[string]config.Shortcode
+		Markdown   config.Markdown
+	}{manifest.Partials, manifest.Shortcodes, manifest.Markdown})
+	c.settings.manifest = manifest
+	c.settings.hash = contentHash(string(settings))
+	return c.settings.hash
+}
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+
+	"github.com/ZacxDev/go-static-site/config"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+)
+
+// tocMarker is replaced by the table of contents when it is a paragraph of
+// its own in markdown
+const tocMarker = "<p>[[toc]]</p>"
+
+// TableOfContents is the heading tree of a markdown page, exposed to
+// templates as `toc`
+type TableOfContents struct {
+	Entries []*TOCEntry
+}
+
+// TOCEntry is a heading, Children are the headings nested below it
+type TOCEntry struct {
+	Level    int
+	ID       string
+	Title    string
+	Children []*TOCEntry
+}
+
+// IsEmpty reports whether the page has no headings within the configured
+// levels
+func (t *TableOfContents) IsEmpty() bool {
+	return len(t.Entries) == 0
+}
+
+// HTML renders the table of contents as nested lists inside a <nav>, it
+// renders nothing when there are no headings
+func (t *TableOfContents) HTML() template.HTML {
+	if t.IsEmpty() {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(`<nav class="toc">`)
+	writeTOCList(&b, t.Entries)
+	b.WriteString("</nav>")
+	return template.HTML(b.String())
+}
+
+func writeTOCList(b *strings.Builder, entries []*TOCEntry) {
+	b.WriteString("<ul>")
+	for _, entry := range entries {
+		b.WriteString(`<li><a href="#`)
+		b.WriteString(template.HTMLEscapeString(entry.ID))
+		b.WriteString(`">`)
+		b.WriteString(template.HTMLEscapeString(entry.Title))
+		b.WriteString("</a>")
+		if len(entry.Children) > 0 {
+			writeTOCList(b, entry.Children)
+		}
+		b.WriteString("</li>")
+	}
+	b.WriteString("</ul>")
+}
+
+// buildTOC collects the headings of doc within the configured levels. IDs
+// are made unique the same way the HTML renderer does so links match the
+// rendered anchors
+func buildTOC(doc ast.Node, opts html.RendererOptions, levels config.TOC) *TableOfContents {
+	min, max := levels.Levels()
+	ids := html.NewRenderer(opts)
+	toc := &TableOfContents{}
+
+	// stack holds the last entry seen at each depth of the tree
+	var stack []*TOCEntry
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering || heading.HeadingID == "" {
+			return ast.GoToNext
+		}
+		id := ids.EnsureUniqueHeadingID(heading.HeadingID)
+		if heading.Level < min || heading.Level > max {
+			return ast.SkipChildren
+		}
+
+		entry := &TOCEntry{Level: heading.Level, ID: id, Title: headingText(heading)}
+		for len(stack) > 0 && stack[len(stack)-1].Level >= entry.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			toc.Entries = append(toc.Entries, entry)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, entry)
+		}
+		stack = append(stack, entry)
+
+		return ast.SkipChildren
+	})
+
+	return toc
+}
+
+// headingText is the plain text of a heading, without its inline markup
+func headingText(heading *ast.Heading) string {
+	var b bytes.Buffer
+	ast.WalkFunc(heading, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.Text:
+			b.Write(n.Literal)
+		case *ast.Code:
+			b.Write(n.Literal)
+		}
+		return ast.GoToNext
+	})
+	return strings.TrimSpace(b.String())
+}
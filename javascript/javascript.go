@@ -13,6 +13,54 @@ import (
 
 var isProd = os.Getenv("NODE_ENV")
 
+// Diagnostic is a single esbuild error or warning
+type Diagnostic struct {
+	File     string
+	Line     int
+	Column   int
+	LineText string
+	Text     string
+}
+
+func (d Diagnostic) String() string {
+	if d.File == "" {
+		return d.Text
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Text)
+}
+
+// BuildError is returned when esbuild fails to compile a javascript target
+type BuildError struct {
+	Target      string
+	Diagnostics []Diagnostic
+}
+
+func (e *BuildError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "failed to compile javascript target %s", e.Target)
+	for _, d := range e.Diagnostics {
+		b.WriteString("\n  ")
+		b.WriteString(d.String())
+	}
+	return b.String()
+}
+
+func newBuildError(target string, messages []api.Message) *BuildError {
+	be := &BuildError{Target: target}
+	for _, msg := range messages {
+		d := Diagnostic{Text: msg.Text}
+		if msg.Location != nil {
+			d.File = msg.Location.File
+			d.Line = msg.Location.Line
+			// esbuild columns are 0-based
+			d.Column = msg.Location.Column + 1
+			d.LineText = msg.Location.LineText
+		}
+		be.Diagnostics = append(be.Diagnostics, d)
+	}
+	return be
+}
+
 func CompileJSTarget(targets map[string]config.JavascriptTarget) (map[string]string, error) {
 	emitted := make(map[string]string, 0)
 	for targetName, target := range targets {
@@ -34,7 +82,7 @@ func CompileJSTarget(targets map[string]config.JavascriptTarget) (map[string]str
 		})
 
 		if len(result.Errors) > 0 {
-			os.Exit(1)
+			return nil, newBuildError(targetName, result.Errors)
 		}
 
 		// Separate files with and without .map extension
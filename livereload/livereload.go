@@ -0,0 +1,177 @@
+package livereload
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventsPath is where the injected script subscribes to reload events
+const EventsPath = "/__livereload"
+
+// Event types pushed to the browser
+const (
+	EventReload = "reload"
+	EventCSS    = "css"
+)
+
+const script = `<script>
+(function () {
+  var source = new EventSource("` + EventsPath + `");
+  source.addEventListener("` + EventReload + `", function () {
+    window.location.reload();
+  });
+  source.addEventListener("` + EventCSS + `", function (e) {
+    var links = document.querySelectorAll('link[rel="stylesheet"]');
+    var swapped = false;
+    links.forEach(function (link) {
+      var url = new URL(link.href, window.location.href);
+      if (url.pathname !== e.data) {
+        return;
+      }
+      url.searchParams.set("livereload", Date.now());
+      link.href = url.toString();
+      swapped = true;
+    });
+    if (!swapped) {
+      window.location.reload();
+    }
+  });
+})();
+</script>
+`
+
+// Broker fans out reload events to every connected browser over
+// Server-Sent Events
+type Broker struct {
+	mu      sync.Mutex
+	clients map[chan event]bool
+}
+
+type event struct {
+	name string
+	data string
+}
+
+func NewBroker() *Broker {
+	return &Broker{clients: make(map[chan event]bool)}
+}
+
+// Broadcast sends an event to every connected browser
+func (b *Broker) Broadcast(name string, data string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for client := range b.clients {
+		select {
+		case client <- event{name: name, data: data}:
+		default:
+			// Drop the event for clients that aren't keeping up, the next
+			// one will bring them back in sync
+		}
+	}
+}
+
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	client := make(chan event, 8)
+	b.mu.Lock()
+	b.clients[client] = true
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, client)
+		b.mu.Unlock()
+	}()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case ev := <-client:
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.name, ev.data)
+			flusher.Flush()
+		}
+	}
+}
+
+// InjectScript adds the live reload client to every HTML response served by next
+func InjectScript(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bw := &bufferedWriter{header: make(http.Header), status: http.StatusOK}
+		next.ServeHTTP(bw, r)
+
+		body := bw.body.Bytes()
+		if strings.HasPrefix(bw.header.Get("Content-Type"), "text/html") {
+			body = injectBeforeBodyClose(body)
+			bw.header.Set("Content-Length", strconv.Itoa(len(body)))
+		}
+
+		for k, v := range bw.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(bw.status)
+		w.Write(body)
+	})
+}
+
+func injectBeforeBodyClose(body []byte) []byte {
+	i := bytes.LastIndex(bytes.ToLower(body), []byte("</body>"))
+	if i == -1 {
+		return append(body, script...)
+	}
+
+	out := make([]byte, 0, len(body)+len(script))
+	out = append(out, body[:i]...)
+	out = append(out, script...)
+	return append(out, body[i:]...)
+}
+
+// bufferedWriter holds a response so it can be modified before being sent
+type bufferedWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (bw *bufferedWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw *bufferedWriter) WriteHeader(status int) {
+	if bw.wroteHeader {
+		return
+	}
+	bw.wroteHeader = true
+	bw.status = status
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+	bw.wroteHeader = true
+	if bw.header.Get("Content-Type") == "" {
+		bw.header.Set("Content-Type", http.DetectContentType(b))
+	}
+	return bw.body.Write(b)
+}
@@ -0,0 +1,139 @@
+package livereload
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Watcher polls a set of files and directories for changes. Polling keeps
+// the dev server free of platform specific notification APIs and is cheap
+// enough for the size of a typical site
+type Watcher struct {
+	Interval time.Duration
+
+	mu       sync.Mutex
+	paths    []string
+	ignore   []string
+	snapshot map[string]fileState
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func NewWatcher(interval time.Duration) *Watcher {
+	return &Watcher{
+		Interval: interval,
+		snapshot: make(map[string]fileState),
+	}
+}
+
+// SetPaths replaces the watched files and directories, directories are
+// watched recursively. Anything under an ignored path is skipped
+func (w *Watcher) SetPaths(paths []string, ignore []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.paths = paths
+	w.ignore = ignore
+	w.snapshot = w.scan()
+}
+
+// Run polls until stop is closed, calling onChange with the sorted list of
+// created, modified and deleted files
+func (w *Watcher) Run(stop <-chan struct{}, onChange func(changed []string)) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			changed := w.poll()
+			if len(changed) > 0 {
+				onChange(changed)
+			}
+		}
+	}
+}
+
+func (w *Watcher) poll() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	next := w.scan()
+	var changed []string
+	for path, state := range next {
+		if prev, ok := w.snapshot[path]; !ok || prev != state {
+			changed = append(changed, path)
+		}
+	}
+	for path := range w.snapshot {
+		if _, ok := next[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	w.snapshot = next
+
+	sort.Strings(changed)
+	return changed
+}
+
+func (w *Watcher) scan() map[string]fileState {
+	states := make(map[string]fileState)
+	for _, root := range w.paths {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if w.isIgnored(path) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			states[filepath.Clean(path)] = fileState{modTime: info.ModTime(), size: info.Size()}
+			return nil
+		})
+	}
+
+	return states
+}
+
+func (w *Watcher) isIgnored(path string) bool {
+	path = filepath.Clean(path)
+	for _, ig := range w.ignore {
+		ig = filepath.Clean(ig)
+		if path == ig || IsWithin(path, ig) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsWithin reports whether path is inside dir
+func IsWithin(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !filepath.IsAbs(rel) && !startsWithParent(rel)
+}
+
+func startsWithParent(rel string) bool {
+	return len(rel) >= 3 && rel[:3] == ".."+string(os.PathSeparator)
+}
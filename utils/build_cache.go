@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const buildCacheVersion = 1
+
+// BuildCache records what every generated page was built from so the next
+// build can skip pages whose inputs have not changed
+type BuildCache struct {
+	Version int                        `json:"version"`
+	Pages   map[string]BuildCacheEntry `json:"pages"`
+
+	// Files lists other outputs the build generated, such as feeds and
+	// robots.txt, so they are only removed if the generator wrote them
+	Files []string `json:"files,omitempty"`
+}
+
+// BuildCacheEntry is the cached state of a single page, keyed by its URL path
+type BuildCacheEntry struct {
+	Output       string            `json:"output"`
+	Fingerprint  string            `json:"fingerprint"`
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+func NewBuildCache() *BuildCache {
+	return &BuildCache{
+		Version: buildCacheVersion,
+		Pages:   make(map[string]BuildCacheEntry),
+	}
+}
+
+// LoadBuildCache reads the cache at path, a missing or outdated cache is
+// treated as empty
+func LoadBuildCache(path string) (*BuildCache, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewBuildCache(), nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var cache BuildCache
+	err = json.Unmarshal(data, &cache)
+	if err != nil || cache.Version != buildCacheVersion || cache.Pages == nil {
+		return NewBuildCache(), nil
+	}
+
+	return &cache, nil
+}
+
+func (c *BuildCache) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(os.WriteFile(path, data, 0644))
+}
+
+// HasFile reports whether path was generated by the build
+func (c *BuildCache) HasFile(path string) bool {
+	for _, f := range c.Files {
+		if f == path {
+			return true
+		}
+	}
+	return false
+}
+
+// AddFile records path as generated by the build
+func (c *BuildCache) AddFile(path string) {
+	if !c.HasFile(path) {
+		c.Files = append(c.Files, path)
+	}
+}
+
+// IsFresh reports whether entry can be reused for a page with the given
+// fingerprint, every dependency must still hash to the recorded value and
+// the output must still exist
+func (e BuildCacheEntry) IsFresh(fingerprint string, hasher *FileHasher) bool {
+	if e.Fingerprint != fingerprint {
+		return false
+	}
+
+	if _, err := os.Stat(e.Output); err != nil {
+		return false
+	}
+
+	for file, sum := range e.Dependencies {
+		if hasher.Hash(file) != sum {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FileHasher hashes file contents, memoizing results for the lifetime of a
+// build since many pages share the same layout and partials
+type FileHasher struct {
+	mu     sync.Mutex
+	hashes map[string]string
+}
+
+func NewFileHasher() *FileHasher {
+	return &FileHasher{hashes: make(map[string]string)}
+}
+
+// Hash returns the hex sha256 of the file, or an empty string if it can't be read
+func (h *FileHasher) Hash(path string) string {
+	h.mu.Lock()
+	sum, ok := h.hashes[path]
+	h.mu.Unlock()
+	if ok {
+		return sum
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		s := sha256.Sum256(data)
+		sum = hex.EncodeToString(s[:])
+	}
+
+	h.mu.Lock()
+	h.hashes[path] = sum
+	h.mu.Unlock()
+
+	return sum
+}
+
+// HashAll hashes every file in paths
+func (h *FileHasher) HashAll(paths []string) map[string]string {
+	sums := make(map[string]string, len(paths))
+	for _, p := range paths {
+		sums[p] = h.Hash(p)
+	}
+
+	return sums
+}
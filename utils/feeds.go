@@ -0,0 +1,334 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+// Feed is a list of items to publish as RSS, Atom or JSON Feed, every URL
+// must be absolute
+type Feed struct {
+	Title       string
+	Description string
+	// Link is the page the feed belongs to, FeedURL the feed itself
+	Link     string
+	FeedURL  string
+	Language string
+	Items    []FeedItem
+}
+
+type FeedItem struct {
+	ID          string
+	Title       string
+	URL         string
+	Summary     string
+	ContentHTML string
+	Author      string
+	Published   time.Time
+	Updated     time.Time
+	Tags        []string
+}
+
+// GenerateFeed renders feed in format: rss, atom or json
+func GenerateFeed(format string, feed Feed) ([]byte, error) {
+	switch format {
+	case "rss":
+		return GenerateRSS(feed)
+	case "atom":
+		return GenerateAtom(feed)
+	case "json":
+		return GenerateJSONFeed(feed)
+	}
+	return nil, fmt.Errorf("unsupported feed format %s", format)
+}
+
+// FeedContentType returns the content type a feed format is served with
+func FeedContentType(format string) string {
+	switch format {
+	case "rss":
+		return "application/rss+xml; charset=utf-8"
+	case "atom":
+		return "application/atom+xml; charset=utf-8"
+	case "json":
+		return "application/feed+json; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
+
+type rss struct {
+	XMLName      xml.Name   `xml:"rss"`
+	Version      string     `xml:"version,attr"`
+	XmlnsAtom    string     `xml:"xmlns:atom,attr"`
+	XmlnsContent string     `xml:"xmlns:content,attr,omitempty"`
+	XmlnsDC      string     `xml:"xmlns:dc,attr,omitempty"`
+	Channel      rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language,omitempty"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	AtomLink      atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string      `xml:"title"`
+	Link        string      `xml:"link"`
+	GUID        rssGUID     `xml:"guid"`
+	PubDate     string      `xml:"pubDate,omitempty"`
+	Creator     string      `xml:"dc:creator,omitempty"`
+	Categories  []string    `xml:"category"`
+	Description string      `xml:"description,omitempty"`
+	Content     *rssContent `xml:"content:encoded"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssContent struct {
+	Value string `xml:",cdata"`
+}
+
+// GenerateRSS renders feed as RSS 2.0
+func GenerateRSS(feed Feed) ([]byte, error) {
+	doc := rss{
+		Version:   "2.0",
+		XmlnsAtom: "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       feed.Title,
+			Link:        feed.Link,
+			Description: feed.Description,
+			Language:    feed.Language,
+			AtomLink:    atomLink{Href: feed.FeedURL, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	if updated := feedUpdated(feed); !updated.IsZero() {
+		doc.Channel.LastBuildDate = updated.Format(time.RFC1123Z)
+	}
+
+	for _, item := range feed.Items {
+		ri := rssItem{
+			Title:       item.Title,
+			Link:        item.URL,
+			GUID:        rssGUID{IsPermaLink: item.ID == item.URL, Value: item.ID},
+			Categories:  item.Tags,
+			Description: item.Summary,
+		}
+		if !item.Published.IsZero() {
+			ri.PubDate = item.Published.Format(time.RFC1123Z)
+		}
+		// RSS author has to be an email address, authors are names
+		if item.Author != "" {
+			ri.Creator = item.Author
+			doc.XmlnsDC = "http://purl.org/dc/elements/1.1/"
+		}
+		if item.ContentHTML != "" {
+			ri.Content = &rssContent{Value: item.ContentHTML}
+			doc.XmlnsContent = "http://purl.org/rss/1.0/modules/content/"
+		}
+		doc.Channel.Items = append(doc.Channel.Items, ri)
+	}
+
+	return marshalFeedXML(doc)
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"feed"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Lang     string      `xml:"xml:lang,attr,omitempty"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Links    []atomLink  `xml:"link"`
+	Updated  string      `xml:"updated"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published,omitempty"`
+	Updated    string         `xml:"updated"`
+	Author     *atomAuthor    `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary,omitempty"`
+	Content    *atomContent   `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// GenerateAtom renders feed as Atom 1.0
+func GenerateAtom(feed Feed) ([]byte, error) {
+	// Atom requires a date, use the build time when no item has one
+	updated := feedUpdated(feed)
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	doc := atomFeed{
+		Xmlns:    "http://www.w3.org/2005/Atom",
+		Lang:     feed.Language,
+		Title:    feed.Title,
+		Subtitle: feed.Description,
+		ID:       feed.FeedURL,
+		Links: []atomLink{
+			{Href: feed.Link, Rel: "alternate", Type: "text/html"},
+			{Href: feed.FeedURL, Rel: "self", Type: "application/atom+xml"},
+		},
+		Updated: updated.UTC().Format(time.RFC3339),
+	}
+
+	for _, item := range feed.Items {
+		itemUpdated := item.Updated
+		if itemUpdated.IsZero() {
+			itemUpdated = item.Published
+		}
+		if itemUpdated.IsZero() {
+			itemUpdated = updated
+		}
+
+		entry := atomEntry{
+			Title:   item.Title,
+			ID:      item.ID,
+			Link:    atomLink{Href: item.URL, Rel: "alternate", Type: "text/html"},
+			Updated: itemUpdated.UTC().Format(time.RFC3339),
+			Summary: item.Summary,
+		}
+		if !item.Published.IsZero() {
+			entry.Published = item.Published.UTC().Format(time.RFC3339)
+		}
+		if item.Author != "" {
+			entry.Author = &atomAuthor{Name: item.Author}
+		}
+		for _, tag := range item.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		if item.ContentHTML != "" {
+			entry.Content = &atomContent{Type: "html", Value: item.ContentHTML}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	return marshalFeedXML(doc)
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Language    string         `json:"language,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	Title         string           `json:"title,omitempty"`
+	Summary       string           `json:"summary,omitempty"`
+	ContentHTML   string           `json:"content_html,omitempty"`
+	ContentText   string           `json:"content_text,omitempty"`
+	DatePublished string           `json:"date_published,omitempty"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// GenerateJSONFeed renders feed as JSON Feed 1.1
+func GenerateJSONFeed(feed Feed) ([]byte, error) {
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.Title,
+		HomePageURL: feed.Link,
+		FeedURL:     feed.FeedURL,
+		Description: feed.Description,
+		Language:    feed.Language,
+		Items:       []jsonFeedItem{},
+	}
+
+	for _, item := range feed.Items {
+		ji := jsonFeedItem{
+			ID:          item.ID,
+			URL:         item.URL,
+			Title:       item.Title,
+			Summary:     item.Summary,
+			ContentHTML: item.ContentHTML,
+			Tags:        item.Tags,
+		}
+		// Items need content, fall back to the summary
+		if ji.ContentHTML == "" {
+			ji.ContentText = item.Summary
+		}
+		if !item.Published.IsZero() {
+			ji.DatePublished = item.Published.UTC().Format(time.RFC3339)
+		}
+		if !item.Updated.IsZero() {
+			ji.DateModified = item.Updated.UTC().Format(time.RFC3339)
+		}
+		if item.Author != "" {
+			ji.Authors = []jsonFeedAuthor{{Name: item.Author}}
+		}
+		doc.Items = append(doc.Items, ji)
+	}
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(doc)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func marshalFeedXML(doc interface{}) ([]byte, error) {
+	output, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), output...), nil
+}
+
+// feedUpdated is the most recent item date of the feed
+func feedUpdated(feed Feed) time.Time {
+	var latest time.Time
+	for _, item := range feed.Items {
+		for _, t := range []time.Time{item.Published, item.Updated} {
+			if t.After(latest) {
+				latest = t
+			}
+		}
+	}
+	return latest
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ZacxDev/go-static-site/config"
+)
+
+// HighlightCSS renders the stylesheet of a syntax highlighting theme for
+// code highlighted with classes
+func HighlightCSS(theme config.HighlightTheme) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, ".highlight { background-color: %s; color: %s; padding: 1em; overflow-x: auto; }\n", theme.Background, theme.Foreground)
+	b.WriteString(".highlight .line { display: flex; }\n")
+	fmt.Fprintf(&b, ".highlight .line.hl { background-color: %s; }\n", theme.HighlightedLine)
+	fmt.Fprintf(&b, ".highlight .ln { min-width: 2.5em; padding-right: 1em; text-align: right; user-select: none; color: %s; }\n", theme.LineNumber)
+
+	classes := make([]string, 0, len(theme.Tokens))
+	for class := range theme.Tokens {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		fmt.Fprintf(&b, ".highlight .%s { %s; }\n", class, strings.ReplaceAll(theme.Tokens[class], ";", "; "))
+	}
+
+	return []byte(b.String())
+}
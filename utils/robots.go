@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/ZacxDev/go-static-site/config"
+)
+
+// GenerateRobotsTxt renders robots.txt for the given environment, listing
+// sitemapURLs at the end
+func GenerateRobotsTxt(robots *config.Robots, env string, sitemapURLs []string) string {
+	rules := robots.Rules
+	if override, ok := robots.Environments[env]; ok && env != "" {
+		if override.DisallowAll {
+			rules = []config.RobotsRule{{UserAgent: "*", Disallow: []string{"/"}}}
+		} else if len(override.Rules) > 0 {
+			rules = override.Rules
+		}
+	}
+
+	var b strings.Builder
+	for i, rule := range rules {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("User-agent: " + rule.UserAgent + "\n")
+		for _, path := range rule.Allow {
+			b.WriteString("Allow: " + path + "\n")
+		}
+		for _, path := range rule.Disallow {
+			b.WriteString("Disallow: " + path + "\n")
+		}
+		// An empty group must still say something to be valid
+		if len(rule.Allow) == 0 && len(rule.Disallow) == 0 {
+			b.WriteString("Disallow:\n")
+		}
+	}
+
+	if len(sitemapURLs) > 0 {
+		if len(rules) > 0 {
+			b.WriteString("\n")
+		}
+		for _, url := range sitemapURLs {
+			b.WriteString("Sitemap: " + url + "\n")
+		}
+	}
+
+	return b.String()
+}
@@ -4,82 +4,278 @@ import (
 	"encoding/xml"
 	"fmt"
 	"os"
-	"regexp"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// Sitemap protocol limits for a single file
+const (
+	MaxSitemapURLs  = 50000
+	MaxSitemapBytes = 50 * 1024 * 1024
+)
+
+// SitemapIndexName is the index written when the sitemap is split into
+// several files
+const SitemapIndexName = "sitemap_index.xml"
+
 type Sitemap struct {
-	XMLName xml.Name `xml:"urlset"`
-	Xmlns   string   `xml:"xmlns,attr"`
-	Urls    []Url    `xml:"url"`
+	XMLName    xml.Name `xml:"urlset"`
+	Xmlns      string   `xml:"xmlns,attr"`
+	XmlnsXhtml string   `xml:"xmlns:xhtml,attr,omitempty"`
+	Urls       []Url    `xml:"url"`
 }
 
 type Url struct {
-	Loc        string `xml:"loc"`
-	LastMod    string `xml:"lastmod,omitempty"`
-	ChangeFreq string `xml:"changefreq,omitempty"`
-	Priority   string `xml:"priority,omitempty"`
+	Loc        string      `xml:"loc"`
+	LastMod    string      `xml:"lastmod,omitempty"`
+	ChangeFreq string      `xml:"changefreq,omitempty"`
+	Priority   string      `xml:"priority,omitempty"`
+	Alternates []Alternate `xml:"xhtml:link"`
+}
+
+// Alternate links a URL to one of its language variants
+type Alternate struct {
+	Rel      string `xml:"rel,attr"`
+	Hreflang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
+}
+
+// SitemapEntry is a single page to list in the sitemap, Loc and the
+// alternate URLs must be absolute
+type SitemapEntry struct {
+	Loc        string
+	LastMod    time.Time
+	ChangeFreq string
+	Priority   *float64
+	// Alternates maps hreflang values, including x-default, to the URL of
+	// that language's variant of the page
+	Alternates []SitemapAlternate
+	// Group is the shard key used when splitting the sitemap, e.g. the
+	// page's language
+	Group string
+}
+
+type SitemapAlternate struct {
+	Hreflang string
+	Href     string
+}
+
+type SitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	Sitemaps []SitemapRef `xml:"sitemap"`
+}
+
+type SitemapRef struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// SitemapFile is a generated sitemap or sitemap index, Name is relative to
+// the site root
+type SitemapFile struct {
+	Name    string
+	Content []byte
+}
+
+// SitemapOptions controls how entries are split across files
+type SitemapOptions struct {
+	// Origin is prepended to file names in the sitemap index
+	Origin  string
+	MaxURLs int
+	// Grouped writes a separate set of files per entry Group
+	Grouped bool
 }
 
-func GenerateSitemaps(routes []string) error {
-	xmlOutput, err := GenerateSitemapContent(routes)
+// BuildSitemaps renders entries into sitemap files. A site that fits in a
+// single ungrouped file gets just sitemap.xml, otherwise entries are split
+// into sitemap-N.xml (or sitemap-<group>-N.xml) files listed by
+// sitemap_index.xml, which is also served as sitemap.xml. The first file
+// returned is always the root sitemap.xml
+func BuildSitemaps(entries []SitemapEntry, opts SitemapOptions) ([]SitemapFile, error) {
+	maxURLs := opts.MaxURLs
+	if maxURLs <= 0 || maxURLs > MaxSitemapURLs {
+		maxURLs = MaxSitemapURLs
+	}
+
+	// Split entries by group, keeping groups in the order first seen
+	var groups []string
+	byGroup := make(map[string][]SitemapEntry)
+	for _, entry := range entries {
+		group := ""
+		if opts.Grouped {
+			group = entry.Group
+		}
+		if _, ok := byGroup[group]; !ok {
+			groups = append(groups, group)
+		}
+		byGroup[group] = append(byGroup[group], entry)
+	}
+
+	var shards [][]SitemapEntry
+	var shardGroups []string
+	for _, group := range groups {
+		for _, shard := range shardEntries(byGroup[group], maxURLs) {
+			shards = append(shards, shard)
+			shardGroups = append(shardGroups, group)
+		}
+	}
+
+	if len(shards) <= 1 && !opts.Grouped {
+		content, err := GenerateSitemapContent(entries)
+		if err != nil {
+			return nil, err
+		}
+		return []SitemapFile{{Name: "sitemap.xml", Content: []byte(xml.Header + content)}}, nil
+	}
+
+	index := SitemapIndex{Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	var files []SitemapFile
+	counts := make(map[string]int)
+	for i, shard := range shards {
+		group := shardGroups[i]
+		counts[group]++
+		name := fmt.Sprintf("sitemap-%d.xml", counts[group])
+		if group != "" {
+			name = fmt.Sprintf("sitemap-%s-%d.xml", group, counts[group])
+		}
+
+		content, err := GenerateSitemapContent(shard)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, SitemapFile{Name: name, Content: []byte(xml.Header + content)})
+
+		ref := SitemapRef{Loc: strings.TrimRight(opts.Origin, "/") + "/" + name}
+		if lastMod := latestLastMod(shard); !lastMod.IsZero() {
+			ref.LastMod = lastMod.UTC().Format("2006-01-02")
+		}
+		index.Sitemaps = append(index.Sitemaps, ref)
+	}
+
+	indexOutput, err := xml.MarshalIndent(index, "", "  ")
 	if err != nil {
-		return err
+		return nil, err
 	}
+	indexContent := []byte(xml.Header + string(indexOutput))
 
-	xmlFile, err := os.Create("public/sitemap.xml")
+	return append([]SitemapFile{
+		{Name: "sitemap.xml", Content: indexContent},
+		{Name: SitemapIndexName, Content: indexContent},
+	}, files...), nil
+}
+
+// shardEntries splits entries into chunks within the protocol's URL and
+// size limits
+func shardEntries(entries []SitemapEntry, maxURLs int) [][]SitemapEntry {
+	// Leave room for the XML header and urlset element
+	const overhead = 512
+
+	var shards [][]SitemapEntry
+	var current []SitemapEntry
+	size := overhead
+	for _, entry := range entries {
+		entrySize := estimateEntrySize(entry)
+		if len(current) > 0 && (len(current) >= maxURLs || size+entrySize > MaxSitemapBytes) {
+			shards = append(shards, current)
+			current = nil
+			size = overhead
+		}
+		current = append(current, entry)
+		size += entrySize
+	}
+	if len(current) > 0 {
+		shards = append(shards, current)
+	}
+	return shards
+}
+
+func estimateEntrySize(entry SitemapEntry) int {
+	size := 128 + len(entry.Loc) + len(entry.ChangeFreq)
+	for _, alt := range entry.Alternates {
+		size += 64 + len(alt.Hreflang) + len(alt.Href)
+	}
+	return size
+}
+
+func latestLastMod(entries []SitemapEntry) time.Time {
+	var latest time.Time
+	for _, entry := range entries {
+		if entry.LastMod.After(latest) {
+			latest = entry.LastMod
+		}
+	}
+	return latest
+}
+
+// WriteSitemaps writes sitemap files into public and removes sitemap files
+// left over from a previous, larger build
+func WriteSitemaps(files []SitemapFile) error {
+	var err error
+	written := make(map[string]bool)
+	for _, file := range files {
+		path := filepath.Join("public", file.Name)
+		err = os.WriteFile(path, file.Content, 0644)
+		if err != nil {
+			return err
+		}
+		written[path] = true
+	}
+
+	stale, err := filepath.Glob(filepath.Join("public", "sitemap*.xml"))
 	if err != nil {
 		return err
 	}
-	defer xmlFile.Close()
-
-	xmlFile.Write([]byte(xml.Header))
-	xmlFile.Write([]byte(xmlOutput))
+	for _, path := range stale {
+		if !written[path] {
+			os.Remove(path)
+		}
+	}
 
 	return nil
 }
 
-func GenerateSitemapContent(routes []string) (string, error) {
-	baseURL := "https://mylinksprofile.com"
+// SitemapRoot returns the name of the file crawlers should be pointed at,
+// the index when the sitemap is split and sitemap.xml otherwise
+func SitemapRoot(files []SitemapFile) string {
+	for _, file := range files {
+		if file.Name == SitemapIndexName {
+			return file.Name
+		}
+	}
+	return "sitemap.xml"
+}
+
+// GenerateSitemapContent builds a sitemap listing entries
+func GenerateSitemapContent(entries []SitemapEntry) (string, error) {
 	sitemap := Sitemap{
 		Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9",
 	}
 
-	// Regex to match language pattern in routes
-	langPattern := regexp.MustCompile(`\/\{lang:([^}]+)\}\/`)
-
-	// Process each route
-	for _, route := range routes {
-		matches := langPattern.FindStringSubmatch(route)
-		if len(matches) > 1 {
-			// Extract supported languages from the pattern
-			langs := strings.Split(matches[1], "|")
-
-			// Base route without the language pattern
-			baseRoute := langPattern.ReplaceAllString(route, "/")
-
-			// Generate URLs for each supported language
-			for _, lang := range langs {
-				url := Url{
-					Loc:     fmt.Sprintf("%s/%s%s", baseURL, lang, baseRoute),
-					LastMod: time.Now().Format("2006-01-02"),
-				}
-				sitemap.Urls = append(sitemap.Urls, url)
-			}
-		} else {
-			// Handle non-language specific routes
-			// Skip if the route is empty or just a slash
-			if route == "" || route == "/" {
-				continue
-			}
-
-			url := Url{
-				Loc:     fmt.Sprintf("%s%s", baseURL, route),
-				LastMod: time.Now().Format("2006-01-02"),
-			}
-			sitemap.Urls = append(sitemap.Urls, url)
+	for _, entry := range entries {
+		url := Url{
+			Loc:        entry.Loc,
+			ChangeFreq: entry.ChangeFreq,
+		}
+		if !entry.LastMod.IsZero() {
+			url.LastMod = entry.LastMod.UTC().Format("2006-01-02")
+		}
+		if entry.Priority != nil {
+			url.Priority = strconv.FormatFloat(*entry.Priority, 'f', -1, 64)
+		}
+		for _, alt := range entry.Alternates {
+			url.Alternates = append(url.Alternates, Alternate{
+				Rel:      "alternate",
+				Hreflang: alt.Hreflang,
+				Href:     alt.Href,
+			})
+		}
+		if len(url.Alternates) > 0 {
+			sitemap.XmlnsXhtml = "http://www.w3.org/1999/xhtml"
 		}
+		sitemap.Urls = append(sitemap.Urls, url)
 	}
 
 	// Generate XML sitemap